@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/aereal/poc-graphql-pqs-server/logging"
+)
+
+const headerTraceID = "X-Trace-Id"
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	logging.Init(logging.WithOutput(os.Stderr), logging.WithDebug(os.Getenv("DEBUG") != ""))
+
+	var (
+		manifestFile  string
+		endpoint      string
+		variablesJSON string
+		clientName    string
+		clientVersion string
+		useGet        bool
+		printCurl     bool
+	)
+	vars := make(varFlags)
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.StringVar(&manifestFile, "manifest", os.Getenv("PERSISTED_QUERY_MANIFEST_FILE"), "manifest file, directory or glob pattern")
+	flags.StringVar(&endpoint, "endpoint", "http://localhost:8080/public/graphql", "public GraphQL endpoint")
+	flags.StringVar(&variablesJSON, "variables", "", "variables as a JSON object")
+	flags.Var(vars, "var", "variable in the form of name=value, where value is parsed as JSON or taken as a string otherwise (repeatable)")
+	flags.StringVar(&clientName, "client-name", "", "value of the "+persistedquery.HeaderClientName+" header")
+	flags.StringVar(&clientVersion, "client-version", "", "value of the "+persistedquery.HeaderClientVersion+" header")
+	flags.BoolVar(&useGet, "get", false, "send the request with GET")
+	flags.BoolVar(&printCurl, "curl", false, "print the curl command instead of sending the request")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [flags] OPERATION_NAME\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return 1
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	manifest, err := persistedquery.ReadManifestFiles(manifestFile)
+	if err != nil {
+		slog.Error("failed to read manifest", slog.String("error", err.Error()))
+		return 1
+	}
+	op, ok := findOperation(manifest.Manifest, flags.Arg(0))
+	if !ok {
+		slog.Error("operation not found in the manifest", slog.String("name", flags.Arg(0)))
+		return 1
+	}
+	variables := make(map[string]any)
+	if variablesJSON != "" {
+		if err := json.Unmarshal([]byte(variablesJSON), &variables); err != nil {
+			slog.Error("malformed -variables", slog.String("error", err.Error()))
+			return 1
+		}
+	}
+	for name, value := range vars {
+		variables[name] = value
+	}
+
+	req, err := buildRequest(endpoint, op, variables, useGet)
+	if err != nil {
+		slog.Error("failed to build request", slog.String("error", err.Error()))
+		return 1
+	}
+	if clientName != "" {
+		req.header.Set(persistedquery.HeaderClientName, clientName)
+	}
+	if clientVersion != "" {
+		req.header.Set(persistedquery.HeaderClientVersion, clientVersion)
+	}
+	if printCurl {
+		fmt.Println(req.curl())
+		return 0
+	}
+	failed, err := req.send(os.Stdout)
+	if err != nil {
+		slog.Error("request failure", slog.String("error", err.Error()))
+		return 1
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func findOperation(manifest *apollo.Manifest, name string) (apollo.Operation, bool) {
+	for _, op := range manifest.Operations {
+		if op.Name == name {
+			return op, true
+		}
+	}
+	return apollo.Operation{}, false
+}
+
+type request struct {
+	method string
+	url    string
+	header http.Header
+	body   []byte
+}
+
+func buildRequest(endpoint string, op apollo.Operation, variables map[string]any, useGet bool) (*request, error) {
+	extensions := map[string]any{"persistedQuery": map[string]any{"version": 1, "sha256Hash": op.ID}}
+	req := &request{url: endpoint, header: make(http.Header)}
+	if useGet {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		params := u.Query()
+		params.Set("operationName", op.Name)
+		if len(variables) > 0 {
+			b, err := json.Marshal(variables)
+			if err != nil {
+				return nil, err
+			}
+			params.Set("variables", string(b))
+		}
+		b, err := json.Marshal(extensions)
+		if err != nil {
+			return nil, err
+		}
+		params.Set("extensions", string(b))
+		u.RawQuery = params.Encode()
+		req.method = http.MethodGet
+		req.url = u.String()
+		return req, nil
+	}
+	payload := map[string]any{"operationName": op.Name, "extensions": extensions}
+	if len(variables) > 0 {
+		payload["variables"] = variables
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req.method = http.MethodPost
+	req.header.Set("Content-Type", "application/json")
+	req.body = b
+	return req, nil
+}
+
+func (r *request) curl() string {
+	args := []string{"curl", "-sS"}
+	if r.method != http.MethodGet {
+		args = append(args, "-X", r.method)
+	}
+	names := make([]string, 0, len(r.header))
+	for name := range r.header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "-H", shellQuote(name+": "+r.header.Get(name)))
+	}
+	if r.body != nil {
+		args = append(args, "--data-raw", shellQuote(string(r.body)))
+	}
+	return strings.Join(append(args, shellQuote(r.url)), " ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// send sends the request and prints the pretty-printed response. It reports whether the response has errors.
+func (r *request) send(w io.Writer) (bool, error) {
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req, err := http.NewRequest(r.method, r.url, body)
+	if err != nil {
+		return false, err
+	}
+	req.Header = r.header
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprintf(os.Stderr, "status: %s\n", resp.Status)
+	if traceID := resp.Header.Get(headerTraceID); traceID != "" {
+		fmt.Fprintf(os.Stderr, "trace id: %s\n", traceID)
+	}
+	var out struct {
+		Data       json.RawMessage `json:"data,omitempty"`
+		Errors     json.RawMessage `json:"errors,omitempty"`
+		Extensions json.RawMessage `json:"extensions,omitempty"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		_, _ = w.Write(b)
+		return true, errors.New("response is not JSON")
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return false, err
+	}
+	return len(out.Errors) > 0 || resp.StatusCode != http.StatusOK, nil
+}
+
+// varFlags collects -var flags.
+type varFlags map[string]any
+
+func (f varFlags) String() string { return "" }
+
+func (f varFlags) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("must be in the form of name=value: %q", s)
+	}
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		v = value
+	}
+	f[name] = v
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aereal/poc-graphql-pqs-server/domain"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/aereal/poc-graphql-pqs-server/infra"
+	"github.com/aereal/poc-graphql-pqs-server/logging"
+)
+
+const (
+	exitOK = iota
+	exitError
+	exitStillInUse
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	logging.Init(logging.WithOutput(os.Stderr), logging.WithDebug(os.Getenv("DEBUG") != ""))
+
+	var (
+		asJSON    bool
+		usageFile string
+		usageDB   bool
+		since     time.Duration
+	)
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.BoolVar(&asJSON, "json", false, "print the report as JSON")
+	flags.StringVar(&usageFile, "usage-file", "", "usage JSON fetched from /admin/usage")
+	flags.BoolVar(&usageDB, "usage-db", false, "read the usage from the database configured by DB_* environment variables")
+	flags.DurationVar(&since, "since", time.Hour*24*30, "only the usage recorded within the duration is considered on -usage-db")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [flags] OLD_MANIFEST NEW_MANIFEST\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return exitError
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitError
+	}
+
+	oldManifest, err := persistedquery.ReadManifestFiles(flags.Arg(0))
+	if err != nil {
+		slog.Error("failed to read old manifest", slog.String("error", err.Error()))
+		return exitError
+	}
+	newManifest, err := persistedquery.ReadManifestFiles(flags.Arg(1))
+	if err != nil {
+		slog.Error("failed to read new manifest", slog.String("error", err.Error()))
+		return exitError
+	}
+
+	var usages []persistedquery.UsageStat
+	switch {
+	case usageFile != "":
+		usages, err = readUsageFile(usageFile)
+	case usageDB:
+		usages, err = readUsageDB(context.Background(), since)
+	}
+	if err != nil {
+		slog.Error("failed to read usage", slog.String("error", err.Error()))
+		return exitError
+	}
+
+	r := buildReport(apollo.Compare(oldManifest.Manifest, newManifest.Manifest), newManifest.Aliases, usages)
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			slog.Error("failed to encode report", slog.String("error", err.Error()))
+			return exitError
+		}
+	} else {
+		r.print(os.Stdout)
+	}
+	if r.StillInUse > 0 {
+		return exitStillInUse
+	}
+	return exitOK
+}
+
+type report struct {
+	*apollo.Diff
+	// Usages maps the IDs of the removed and changed operations and the removed aliases to their usage.
+	Usages     map[string][]persistedquery.UsageStat `json:"usages"`
+	StillInUse int                                   `json:"stillInUse"`
+}
+
+// buildReport reports the usage of the dropped IDs. The operations that the new aliases keep serving are not dropped.
+func buildReport(diff *apollo.Diff, newAliases []apollo.Alias, usages []persistedquery.UsageStat) *report {
+	byID := make(map[string][]persistedquery.UsageStat)
+	for _, u := range usages {
+		if u.Executions > 0 {
+			byID[u.OperationID] = append(byID[u.OperationID], u)
+		}
+	}
+	r := &report{Diff: diff, Usages: make(map[string][]persistedquery.UsageStat)}
+	aliased := make(map[string]bool, len(newAliases))
+	for _, alias := range newAliases {
+		aliased[alias.ID] = true
+	}
+	dropped := make([]string, 0, len(diff.Removed)+len(diff.Changed)+len(diff.RemovedAliases))
+	for _, op := range diff.Removed {
+		dropped = append(dropped, op.ID)
+	}
+	for _, c := range diff.Changed {
+		dropped = append(dropped, c.Old.ID)
+	}
+	for _, alias := range diff.RemovedAliases {
+		dropped = append(dropped, alias.ID)
+	}
+	for _, id := range dropped {
+		if aliased[id] {
+			continue
+		}
+		if u, ok := byID[id]; ok {
+			r.Usages[id] = u
+			r.StillInUse++
+		}
+	}
+	return r
+}
+
+func (r *report) print(w io.Writer) {
+	if r.Empty() {
+		fmt.Fprintln(w, "no changes")
+		return
+	}
+	if len(r.Added) > 0 {
+		fmt.Fprintf(w, "Added (%d):\n", len(r.Added))
+		for _, op := range r.Added {
+			fmt.Fprintf(w, "  + %s (%s)\n", op.Name, op.ID)
+		}
+	}
+	if len(r.Removed) > 0 {
+		fmt.Fprintf(w, "Removed (%d):\n", len(r.Removed))
+		for _, op := range r.Removed {
+			fmt.Fprintf(w, "  - %s (%s)%s\n", op.Name, op.ID, r.usageNote(op.ID))
+		}
+	}
+	if len(r.Changed) > 0 {
+		fmt.Fprintf(w, "Changed (%d):\n", len(r.Changed))
+		for _, c := range r.Changed {
+			fmt.Fprintf(w, "  ~ %s (%s -> %s)%s\n", c.Name, c.Old.ID, c.New.ID, r.usageNote(c.Old.ID))
+		}
+	}
+	if len(r.AddedAliases) > 0 {
+		fmt.Fprintf(w, "Added aliases (%d):\n", len(r.AddedAliases))
+		for _, alias := range r.AddedAliases {
+			fmt.Fprintf(w, "  + %s -> %s\n", alias.ID, alias.Target)
+		}
+	}
+	if len(r.RemovedAliases) > 0 {
+		fmt.Fprintf(w, "Removed aliases (%d):\n", len(r.RemovedAliases))
+		for _, alias := range r.RemovedAliases {
+			fmt.Fprintf(w, "  - %s -> %s%s\n", alias.ID, alias.Target, r.usageNote(alias.ID))
+		}
+	}
+	if r.StillInUse > 0 {
+		fmt.Fprintf(w, "\n%d dropped operations are still in use\n", r.StillInUse)
+	}
+}
+
+func (r *report) usageNote(id string) string {
+	usages, ok := r.Usages[id]
+	if !ok {
+		return ""
+	}
+	var executions uint64
+	var lastSeen time.Time
+	clients := make([]string, 0, len(usages))
+	for _, u := range usages {
+		executions += u.Executions
+		if u.LastSeen.After(lastSeen) {
+			lastSeen = u.LastSeen
+		}
+		name := u.ClientName
+		if name == "" {
+			name = "(unknown)"
+		}
+		clients = append(clients, name)
+	}
+	sort.Strings(clients)
+	return fmt.Sprintf(" [STILL IN USE: %d executions by %s, last seen at %s]", executions, strings.Join(clients, ", "), lastSeen.Format(time.RFC3339))
+}
+
+func readUsageFile(file string) ([]persistedquery.UsageStat, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	var payload struct {
+		Usages []persistedquery.UsageStat `json:"usages"`
+	}
+	if err := json.NewDecoder(f).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to decode usage: %w", err)
+	}
+	return payload.Usages, nil
+}
+
+func readUsageDB(ctx context.Context, since time.Duration) ([]persistedquery.UsageStat, error) {
+	db, err := infra.OpenDB(infra.WithAddr(os.Getenv("DB_ADDR")), infra.WithDBName(os.Getenv("DB_NAME")), infra.WithUser(os.Getenv("DB_USER")), infra.WithPassword(os.Getenv("DB_PASSWORD")), infra.WithSSLMode("disable"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DB: %w", err)
+	}
+	defer db.Close()
+	repo := domain.NewOperationUsageRepository(domain.WithDB(db))
+	usages, err := repo.SummarizeOperationUsages(ctx, time.Now().Add(-since))
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]persistedquery.UsageStat, len(usages))
+	for i, u := range usages {
+		stats[i] = persistedquery.UsageStat{
+			OperationID:   u.OperationID,
+			OperationName: u.OperationName,
+			ClientName:    u.ClientName,
+			Executions:    u.Executions,
+			Errors:        u.Errors,
+			LastSeen:      u.RecordedAt,
+		}
+	}
+	return stats, nil
+}
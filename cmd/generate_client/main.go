@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/clientgen"
+	"github.com/aereal/poc-graphql-pqs-server/logging"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	logging.Init(logging.WithOutput(os.Stderr), logging.WithDebug(os.Getenv("DEBUG") != ""))
+
+	var (
+		schemaFile  string
+		output      string
+		packageName string
+		scalars     string
+	)
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.StringVar(&schemaFile, "schema", "etc/core.schema.gql", "GraphQL schema file")
+	flags.StringVar(&output, "o", "", "output file (default: stdout)")
+	flags.StringVar(&packageName, "package", "pqclient", "package name of the generated code")
+	flags.StringVar(&scalars, "scalars", "", "additional scalar mappings in the form of \"Scalar=gotype,...\"")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [flags] MANIFEST\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return 1
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	opts := []clientgen.Option{clientgen.WithPackageName(packageName)}
+	if scalars != "" {
+		for _, entry := range strings.Split(scalars, ",") {
+			name, goType, ok := strings.Cut(entry, "=")
+			if !ok {
+				slog.Error("malformed scalar mapping", slog.String("entry", entry))
+				return 1
+			}
+			opts = append(opts, clientgen.WithScalar(name, goType))
+		}
+	}
+	schema, err := loadSchema(schemaFile)
+	if err != nil {
+		slog.Error("failed to load schema", slog.String("file", schemaFile), slog.String("error", err.Error()))
+		return 1
+	}
+	manifest, err := persistedquery.ReadManifestFiles(flags.Arg(0))
+	if err != nil {
+		slog.Error("failed to read manifest", slog.String("error", err.Error()))
+		return 1
+	}
+	src, err := clientgen.Generate(schema, manifest.Manifest, opts...)
+	if err != nil {
+		slog.Error("failed to generate client", slog.String("error", err.Error()))
+		return 1
+	}
+	if output == "" {
+		_, _ = os.Stdout.Write(src)
+		return 0
+	}
+	if err := os.WriteFile(output, src, 0o644); err != nil {
+		slog.Error("failed to write client", slog.String("error", err.Error()))
+		return 1
+	}
+	slog.Info("client generated", slog.String("file", output), slog.Int("operations", len(manifest.Operations)))
+	return 0
+}
+
+func loadSchema(file string) (*ast.Schema, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return gqlparser.LoadSchema(&ast.Source{Name: file, Input: string(b)})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/logging"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	logging.Init(logging.WithOutput(os.Stderr), logging.WithDebug(os.Getenv("DEBUG") != ""))
+
+	var (
+		schemaFile string
+		output     string
+		pretty     bool
+	)
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.StringVar(&schemaFile, "schema", "etc/core.schema.gql", "GraphQL schema file")
+	flags.StringVar(&output, "o", "", "output file (default: stdout)")
+	flags.BoolVar(&pretty, "pretty", false, "keep the operation bodies indented instead of minifying them")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [flags] DOCUMENTS_DIR\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return 1
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 1
+	}
+
+	schema, err := loadSchema(schemaFile)
+	if err != nil {
+		slog.Error("failed to load schema", slog.String("file", schemaFile), slog.String("error", err.Error()))
+		return 1
+	}
+	sources, err := readDocuments(flags.Arg(0))
+	if err != nil {
+		slog.Error("failed to read documents", slog.String("error", err.Error()))
+		return 1
+	}
+	manifest, err := persistedquery.GenerateManifest(schema, sources, persistedquery.WithPrettyBody(pretty))
+	if err != nil {
+		slog.Error("failed to generate manifest", slog.String("error", err.Error()))
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			slog.Error("failed to create output file", slog.String("error", err.Error()))
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		slog.Error("failed to write manifest", slog.String("error", err.Error()))
+		return 1
+	}
+	slog.Info("manifest generated", slog.Int("operations", len(manifest.Operations)))
+	return 0
+}
+
+func loadSchema(file string) (*ast.Schema, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return gqlparser.LoadSchema(&ast.Source{Name: file, Input: string(b)})
+}
+
+func readDocuments(dir string) ([]*ast.Source, error) {
+	sources := make([]*ast.Source, 0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".graphql" && ext != ".gql" {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, &ast.Source{Name: path, Input: string(b)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no .graphql documents in %s", dir)
+	}
+	return sources, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aereal/poc-graphql-pqs-server/domain"
+	"github.com/aereal/poc-graphql-pqs-server/graph"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/aereal/poc-graphql-pqs-server/infra"
+	"github.com/aereal/poc-graphql-pqs-server/logging"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	logging.Init(logging.WithOutput(os.Stderr), logging.WithDebug(os.Getenv("DEBUG") != ""))
+
+	var (
+		manifestFile string
+		store        bool
+		showBody     bool
+	)
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.StringVar(&manifestFile, "manifest", "", "approve into the manifest file")
+	flags.BoolVar(&store, "store", false, "approve into the persisted operation store in the database")
+	flags.BoolVar(&showBody, "body", false, "print the operation bodies on list")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [flags] list | approve ID... | reject ID...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return 1
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 1
+	}
+
+	db, err := infra.OpenDB(infra.WithAddr(os.Getenv("DB_ADDR")), infra.WithDBName(os.Getenv("DB_NAME")), infra.WithUser(os.Getenv("DB_USER")), infra.WithPassword(os.Getenv("DB_PASSWORD")), infra.WithSSLMode("disable"))
+	if err != nil {
+		slog.Error("failed to open DB", slog.String("error", err.Error()))
+		return 1
+	}
+	r := &reviewer{
+		pending:   domain.NewPendingOperationRepository(domain.WithDB(db)),
+		persisted: domain.NewPersistedOperationRepository(domain.WithDB(db)),
+	}
+	ctx := context.Background()
+	ids := flags.Args()[1:]
+	switch cmd := flags.Arg(0); cmd {
+	case "list":
+		err = r.list(ctx, showBody)
+	case "approve":
+		switch {
+		case len(ids) == 0:
+			err = errors.New("no operation IDs")
+		case (manifestFile == "") == !store:
+			err = errors.New("either -manifest or -store must be given")
+		case store:
+			err = r.approveIntoStore(ctx, ids)
+		default:
+			err = r.approveIntoManifest(ctx, manifestFile, ids)
+		}
+	case "reject":
+		if len(ids) == 0 {
+			err = errors.New("no operation IDs")
+			break
+		}
+		err = r.reject(ctx, ids)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+	if err != nil {
+		slog.Error("review failure", slog.String("error", err.Error()))
+		return 1
+	}
+	return 0
+}
+
+type reviewer struct {
+	pending   *domain.PendingOperationRepository
+	persisted *domain.PersistedOperationRepository
+}
+
+func (r *reviewer) list(ctx context.Context, showBody bool) error {
+	ops, err := r.pending.ListPendingOperations(ctx, domain.PendingOperationStatusPending)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tCLIENT\tFIRST SEEN")
+	for _, op := range ops {
+		var name string
+		if parsed, err := apollo.NewOperation(op.ID, op.Body); err == nil {
+			name = parsed.Name
+		}
+		client := op.ClientName
+		if op.ClientVersion != "" {
+			client += "@" + op.ClientVersion
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", op.ID, name, client, op.FirstSeenAt.Format(time.RFC3339))
+		if showBody {
+			fmt.Fprintf(w, "\t%s\n", op.Body)
+		}
+	}
+	return w.Flush()
+}
+
+// operations finds the pending operations and validates them against the schema.
+func (r *reviewer) operations(ctx context.Context, ids []string) ([]*domain.PendingOperation, *apollo.Manifest, error) {
+	pendings := make([]*domain.PendingOperation, 0, len(ids))
+	manifest := &apollo.Manifest{Format: apollo.SupportedFormat, Version: apollo.SupportedVersion}
+	for _, id := range ids {
+		pending, err := r.pending.FindPendingOperationByID(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pending.Status != domain.PendingOperationStatusPending {
+			return nil, nil, fmt.Errorf("operation %s is already %s", id, pending.Status)
+		}
+		op, err := apollo.NewOperation(pending.ID, pending.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		pendings = append(pendings, pending)
+		manifest.Operations = append(manifest.Operations, op)
+	}
+	es := graph.NewExecutableSchema(graph.Config{})
+	if err := persistedquery.ValidateManifest(es.Schema(), manifest); err != nil {
+		return nil, nil, err
+	}
+	return pendings, manifest, nil
+}
+
+func (r *reviewer) approveIntoStore(ctx context.Context, ids []string) error {
+	pendings, manifest, err := r.operations(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i, op := range manifest.Operations {
+		pending := pendings[i]
+		if _, err := r.persisted.RegisterPersistedOperation(ctx, &domain.PersistedOperation{ID: op.ID, Name: op.Name, Type: op.Type, Body: op.Body, ClientName: pending.ClientName, ClientVersion: pending.ClientVersion}); err != nil {
+			return err
+		}
+		if _, err := r.pending.ReviewPendingOperation(ctx, op.ID, domain.PendingOperationStatusApproved); err != nil {
+			return err
+		}
+		slog.Info("approved operation into the store", slog.String("id", op.ID), slog.String("name", op.Name))
+	}
+	return nil
+}
+
+func (r *reviewer) approveIntoManifest(ctx context.Context, file string, ids []string) error {
+	_, approved, err := r.operations(ctx, ids)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	manifest, err := apollo.DecodeBytes(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	manifest.Operations = append(manifest.Operations, approved.Operations...)
+	if err := manifest.Validate(); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, append(out, '\n'), 0o644); err != nil {
+		return err
+	}
+	if _, err := os.Stat(file + persistedquery.SignatureFileSuffix); err == nil {
+		slog.Warn("the manifest must be signed again", slog.String("file", file))
+	}
+	for _, op := range approved.Operations {
+		if _, err := r.pending.ReviewPendingOperation(ctx, op.ID, domain.PendingOperationStatusApproved); err != nil {
+			return err
+		}
+		slog.Info("approved operation into the manifest", slog.String("id", op.ID), slog.String("name", op.Name), slog.String("file", file))
+	}
+	return nil
+}
+
+func (r *reviewer) reject(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		if _, err := r.pending.ReviewPendingOperation(ctx, id, domain.PendingOperationStatusRejected); err != nil {
+			return err
+		}
+		slog.Info("rejected operation", slog.String("id", id))
+	}
+	return nil
+}
@@ -2,21 +2,26 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/aereal/poc-graphql-pqs-server/domain"
 	"github.com/aereal/poc-graphql-pqs-server/graph"
 	"github.com/aereal/poc-graphql-pqs-server/graph/loaders"
-	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
 	"github.com/aereal/poc-graphql-pqs-server/graph/resolvers"
 	"github.com/aereal/poc-graphql-pqs-server/infra"
 	"github.com/aereal/poc-graphql-pqs-server/logging"
 	"github.com/aereal/poc-graphql-pqs-server/otel/otelinstrument"
 	"github.com/aereal/poc-graphql-pqs-server/web"
+	"golang.org/x/time/rate"
 )
 
 func main() {
@@ -29,7 +34,8 @@ func run() int {
 
 	logging.Init(logging.WithOutput(os.Stdout), logging.WithDebug(isDebug), logging.WithStacktrace(isVerbose))
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	shutdown, err := otelinstrument.Instrument(ctx, otelinstrument.WithShutdownGrace(time.Second*5), otelinstrument.WithSetGlobalTracerProvider(true))
 	if err != nil {
@@ -43,16 +49,119 @@ func run() int {
 		slog.Error("failed to open DB", slog.String("error", err.Error()))
 		return 1
 	}
-	manifest, err := readManifest(os.Getenv("PERSISTED_QUERY_MANIFEST_FILE"))
-	if err != nil {
-		slog.Error("failed to read manifest", slog.String("error", err.Error()))
-		return 1
-	}
 	characterRepo := domain.NewCharacterRepository(domain.WithDB(db))
 	loaderRoot := loaders.New(loaders.WithCharacterRepository(characterRepo))
 	resolverRoot := resolvers.New(resolvers.WithCharacterRepository(characterRepo))
 	es := graph.NewExecutableSchema(graph.Config{Resolvers: resolverRoot})
-	srv := web.New(web.WithPort(os.Getenv("PORT")), web.WithExecutableSchema(es), web.WithLoaderRoot(loaderRoot), web.WithPersistedQueryList(apollo.New(manifest)))
+	serverOpts := make([]web.Option, 0)
+	// the manifests are loaded only if every rate limit class they declare is configured
+	var rateLimitClasses []string
+	if v := os.Getenv("RATE_LIMIT_CLASSES"); v != "" {
+		policyOpts, classes, err := parseRateLimitClasses(v)
+		if err != nil {
+			slog.Error("invalid RATE_LIMIT_CLASSES", slog.String("error", err.Error()))
+			return 1
+		}
+		rateLimitClasses = classes
+		serverOpts = append(serverOpts, web.WithPolicyOptions(policyOpts...))
+	}
+	var queryList graphql.Cache
+	if os.Getenv("PERSISTED_QUERY_STORE") == "database" {
+		var storeOpts []persistedquery.DBStoreOption
+		if v := os.Getenv("PERSISTED_QUERY_CACHE_TTL"); v != "" {
+			ttl, err := time.ParseDuration(v)
+			if err != nil {
+				slog.Error("invalid PERSISTED_QUERY_CACHE_TTL", slog.String("error", err.Error()))
+				return 1
+			}
+			storeOpts = append(storeOpts, persistedquery.WithCacheTTL(ttl))
+		}
+		store, err := persistedquery.NewDBStore(domain.NewPersistedOperationRepository(domain.WithDB(db)), storeOpts...)
+		if err != nil {
+			slog.Error("failed to build persisted operation store", slog.String("error", err.Error()))
+			return 1
+		}
+		queryList = store
+		serverOpts = append(serverOpts, web.WithOperationStore(store))
+	} else if namespaces := os.Getenv("PERSISTED_QUERY_NAMESPACES"); namespaces != "" {
+		lists := make(map[string]graphql.Cache)
+		for _, pair := range strings.Split(namespaces, ",") {
+			client, manifestFile, ok := strings.Cut(pair, "=")
+			if !ok {
+				slog.Error("malformed PERSISTED_QUERY_NAMESPACES", slog.String("entry", pair))
+				return 1
+			}
+			list, err := watchManifest(ctx, es, manifestFile, rateLimitClasses)
+			if err != nil {
+				slog.Error("failed to read manifest", slog.String("client", client), slog.String("error", err.Error()))
+				return 1
+			}
+			lists[client] = list
+		}
+		queryList = persistedquery.NewNamespaces(lists)
+	} else if manifestURL := os.Getenv("PERSISTED_QUERY_MANIFEST_URL"); manifestURL != "" {
+		list, err := watchRemoteManifest(ctx, es, manifestURL, rateLimitClasses)
+		if err != nil {
+			slog.Error("failed to load remote manifest", slog.String("url", manifestURL), slog.String("error", err.Error()))
+			return 1
+		}
+		queryList = list
+	} else {
+		list, err := watchManifest(ctx, es, os.Getenv("PERSISTED_QUERY_MANIFEST_FILE"), rateLimitClasses)
+		if err != nil {
+			slog.Error("failed to read manifest", slog.String("error", err.Error()))
+			return 1
+		}
+		queryList = list
+	}
+	var documentIDPrefixes []string
+	if v := os.Getenv("PERSISTED_DOCUMENT_ID_PREFIXES"); v != "" {
+		documentIDPrefixes = strings.Split(v, ",")
+	}
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	flushInterval := os.Getenv("USAGE_FLUSH_INTERVAL")
+	serverOpts = append(serverOpts, web.WithAdminToken(adminToken))
+	// the usage is recorded only when it is exposed on the admin API or stored
+	if adminToken != "" || flushInterval != "" {
+		usageRecorder := persistedquery.NewUsageRecorder(queryList)
+		if flushInterval != "" {
+			interval, err := time.ParseDuration(flushInterval)
+			if err != nil {
+				slog.Error("invalid USAGE_FLUSH_INTERVAL", slog.String("error", err.Error()))
+				return 1
+			}
+			// the flusher outlives the server so that the final flush includes the requests drained on shutdown
+			flusherCtx, stopFlusher := context.WithCancel(context.WithoutCancel(ctx))
+			flusherDone := make(chan struct{})
+			go func() {
+				defer close(flusherDone)
+				usageRecorder.RunFlusher(flusherCtx, domain.NewOperationUsageRepository(domain.WithDB(db)), interval)
+			}()
+			defer func() {
+				stopFlusher()
+				<-flusherDone
+			}()
+		}
+		serverOpts = append(serverOpts, web.WithUsageRecorder(usageRecorder))
+	}
+	if os.Getenv("PERSISTED_QUERY_CAPTURE_UNKNOWN") != "" {
+		capturer, err := persistedquery.NewPendingCapturer(es.Schema(), domain.NewPendingOperationRepository(domain.WithDB(db)))
+		if err != nil {
+			slog.Error("failed to create pending operation capturer", slog.String("error", err.Error()))
+			return 1
+		}
+		serverOpts = append(serverOpts, web.WithUnknownOperationCapturer(capturer))
+	}
+	if v := os.Getenv("GET_CACHE_MAX_AGE"); v != "" {
+		maxAge, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Error("invalid GET_CACHE_MAX_AGE", slog.String("error", err.Error()))
+			return 1
+		}
+		serverOpts = append(serverOpts, web.WithGetCacheMaxAge(maxAge))
+	}
+	serverOpts = append(serverOpts, web.WithPort(os.Getenv("PORT")), web.WithExecutableSchema(es), web.WithLoaderRoot(loaderRoot), web.WithPersistedQueryList(queryList), web.WithStrictSafelist(os.Getenv("PERSISTED_QUERY_STRICT") != ""), web.WithDocumentIDPrefixes(documentIDPrefixes...))
+	srv := web.New(serverOpts...)
 	if err := srv.Start(ctx); err != nil {
 		slog.Error("server is closed", slog.String("error", err.Error()))
 		return 1
@@ -60,15 +169,107 @@ func run() int {
 	return 0
 }
 
-func readManifest(file string) (*apollo.Manifest, error) {
-	f, err := os.Open(file)
+func watchManifest(ctx context.Context, es graphql.ExecutableSchema, manifestFile string, rateLimitClasses []string) (*persistedquery.ReloadableList, error) {
+	decodeOpts, err := persistedquery.DecodeOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	list, err := persistedquery.NewReloadableList(ctx, func(context.Context) (graphql.Cache, error) {
+		manifest, err := persistedquery.ReadManifestFiles(manifestFile, decodeOpts...)
+		if err != nil {
+			return nil, err
+		}
+		if err := persistedquery.ValidateRateLimitClasses(manifest.Manifest, rateLimitClasses); err != nil {
+			return nil, err
+		}
+		prepared, err := persistedquery.NewPreparedList(es.Schema(), manifest.Manifest)
+		if err != nil {
+			return nil, fmt.Errorf("manifest has invalid operations: %w", err)
+		}
+		for _, op := range manifest.Operations {
+			slog.DebugContext(ctx, "load persisted operation", slog.String("id", op.ID), slog.String("name", op.Name), slog.String("source", manifest.Sources[op.ID]))
+		}
+		return prepared, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	go list.Watch(ctx, persistedquery.WithWatchFile(manifestFile))
+	return list, nil
+}
+
+// watchRemoteManifest loads the manifest from the URL and polls it.
+// PERSISTED_QUERY_MANIFEST_FILE is used as the cache file of the last good manifest.
+func watchRemoteManifest(ctx context.Context, es graphql.ExecutableSchema, manifestURL string, rateLimitClasses []string) (*persistedquery.ReloadableList, error) {
+	remoteOpts := make([]persistedquery.RemoteOption, 0)
+	if cacheFile := os.Getenv("PERSISTED_QUERY_MANIFEST_FILE"); cacheFile != "" {
+		remoteOpts = append(remoteOpts, persistedquery.WithCacheFile(cacheFile))
+	}
+	if v := os.Getenv("PERSISTED_QUERY_MANIFEST_POLL_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PERSISTED_QUERY_MANIFEST_POLL_INTERVAL: %w", err)
+		}
+		remoteOpts = append(remoteOpts, persistedquery.WithRemotePollInterval(interval))
+	}
+	keys, err := persistedquery.TrustedKeysFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		remoteOpts = append(remoteOpts, persistedquery.WithRemoteTrustedKeys(keys...))
+	}
+	decodeOpts, err := persistedquery.DecodeOptionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	remote := persistedquery.NewRemoteManifest(manifestURL, remoteOpts...)
+	list, err := persistedquery.NewReloadableList(ctx, remote.Loader(func(ctx context.Context, data []byte) (graphql.Cache, error) {
+		manifest, err := persistedquery.DecodeManifest(data, decodeOpts...)
+		if err != nil {
+			return nil, err
+		}
+		if err := persistedquery.ValidateRateLimitClasses(manifest, rateLimitClasses); err != nil {
+			return nil, err
+		}
+		prepared, err := persistedquery.NewPreparedList(es.Schema(), manifest)
+		if err != nil {
+			return nil, fmt.Errorf("manifest has invalid operations: %w", err)
+		}
+		slog.DebugContext(ctx, "load remote manifest", slog.String("url", manifestURL), slog.Int("operations", len(manifest.Operations)))
+		return prepared, nil
+	}))
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, err
 	}
-	defer f.Close()
-	var manifest apollo.Manifest
-	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
-		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	go list.Watch(ctx)
+	go remote.Watch(ctx, list)
+	return list, nil
+}
+
+// parseRateLimitClasses parses the rate limit classes in the form of "class=rate:burst,...".
+func parseRateLimitClasses(v string) ([]persistedquery.PolicyOption, []string, error) {
+	opts := make([]persistedquery.PolicyOption, 0)
+	classes := make([]string, 0)
+	for _, entry := range strings.Split(v, ",") {
+		class, limit, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("malformed entry: %q", entry)
+		}
+		r, b, ok := strings.Cut(limit, ":")
+		if !ok {
+			return nil, nil, fmt.Errorf("malformed limit: %q", limit)
+		}
+		perSecond, err := strconv.ParseFloat(r, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rate of %s: %w", class, err)
+		}
+		burst, err := strconv.Atoi(b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("burst of %s: %w", class, err)
+		}
+		opts = append(opts, persistedquery.WithRateLimit(class, rate.Limit(perSecond), burst))
+		classes = append(classes, class)
 	}
-	return &manifest, nil
+	return opts, classes, nil
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/logging"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	logging.Init(logging.WithOutput(os.Stderr), logging.WithDebug(os.Getenv("DEBUG") != ""))
+
+	var (
+		keyFile     string
+		generateKey bool
+	)
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.StringVar(&keyFile, "key", "", "file containing the base64 encoded ed25519 private key (default: $MANIFEST_SIGNING_KEY)")
+	flags.BoolVar(&generateKey, "generate-key", false, "generate a new key pair and print it instead of signing")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s [flags] MANIFEST_FILE...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return 1
+	}
+
+	if generateKey {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			slog.Error("failed to generate key", slog.String("error", err.Error()))
+			return 1
+		}
+		fmt.Printf("private key: %s\n", base64.StdEncoding.EncodeToString(priv.Seed()))
+		fmt.Printf("public key: %s\n", base64.StdEncoding.EncodeToString(pub))
+		return 0
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 1
+	}
+
+	encoded := os.Getenv("MANIFEST_SIGNING_KEY")
+	if keyFile != "" {
+		b, err := os.ReadFile(keyFile)
+		if err != nil {
+			slog.Error("failed to read key file", slog.String("error", err.Error()))
+			return 1
+		}
+		encoded = string(b)
+	}
+	key, err := persistedquery.ParsePrivateKey(encoded)
+	if err != nil {
+		slog.Error("invalid private key", slog.String("error", err.Error()))
+		return 1
+	}
+	for _, file := range flags.Args() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			slog.Error("failed to read manifest", slog.String("file", file), slog.String("error", err.Error()))
+			return 1
+		}
+		if _, err := persistedquery.DecodeManifest(data); err != nil {
+			slog.Error("refuse to sign invalid manifest", slog.String("file", file), slog.String("error", err.Error()))
+			return 1
+		}
+		sigFile := file + persistedquery.SignatureFileSuffix
+		if err := os.WriteFile(sigFile, persistedquery.SignManifest(key, data), 0o644); err != nil {
+			slog.Error("failed to write signature", slog.String("file", sigFile), slog.String("error", err.Error()))
+			return 1
+		}
+		slog.Info("manifest signed", slog.String("file", file), slog.String("signature", sigFile))
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/logging"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	logging.Init(logging.WithOutput(os.Stderr), logging.WithDebug(os.Getenv("DEBUG") != ""))
+
+	file := os.Getenv("PERSISTED_QUERY_MANIFEST_FILE")
+	if len(os.Args) > 1 {
+		file = os.Args[1]
+	}
+	decodeOpts, err := persistedquery.DecodeOptionsFromEnv()
+	if err != nil {
+		slog.Error("invalid manifest decode options", slog.String("error", err.Error()))
+		return 1
+	}
+	manifest, err := persistedquery.ReadManifestFiles(file, decodeOpts...)
+	if err != nil {
+		slog.Error("failed to read manifest", slog.String("file", file), slog.String("error", err.Error()))
+		return 1
+	}
+	es := graph.NewExecutableSchema(graph.Config{})
+	if err := persistedquery.ValidateManifest(es.Schema(), manifest.Manifest); err != nil {
+		for _, opErr := range unwrapJoined(err) {
+			var validationErr *persistedquery.OperationValidationError
+			if !errors.As(opErr, &validationErr) {
+				slog.Error("invalid operation", slog.String("error", opErr.Error()))
+				continue
+			}
+			for _, gqlErr := range validationErr.Errors {
+				slog.Error("invalid operation", slog.String("operation.id", validationErr.ID), slog.String("operation.name", validationErr.Name), slog.String("source", manifest.Sources[validationErr.ID]), slog.String("error", gqlErr.Error()))
+			}
+		}
+		return 1
+	}
+	fmt.Printf("%d operations are valid\n", len(manifest.Operations))
+	return 0
+}
+
+func unwrapJoined(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
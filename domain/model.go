@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 type Element string
 
 const (
@@ -77,3 +79,47 @@ type Character struct {
 	Region        Region     `db:"region"`
 	WeaponKind    WeaponKind `db:"weapon_kind"`
 }
+
+type PersistedOperation struct {
+	ID            string     `db:"id"`
+	Name          string     `db:"name"`
+	Type          string     `db:"type"`
+	Body          string     `db:"body"`
+	ClientName    string     `db:"client_name"`
+	ClientVersion string     `db:"client_version"`
+	CreatedAt     time.Time  `db:"created_at"`
+	RetiredAt     *time.Time `db:"retired_at"`
+}
+
+func (o *PersistedOperation) Retired() bool { return o.RetiredAt != nil }
+
+type OperationUsage struct {
+	OperationID   string    `db:"operation_id"`
+	OperationName string    `db:"operation_name"`
+	ClientName    string    `db:"client_name"`
+	Executions    uint64    `db:"executions"`
+	Errors        uint64    `db:"errors"`
+	LatencyP50Ms  float64   `db:"latency_p50_ms"`
+	LatencyP90Ms  float64   `db:"latency_p90_ms"`
+	LatencyP99Ms  float64   `db:"latency_p99_ms"`
+	RecordedAt    time.Time `db:"recorded_at"`
+}
+
+type PendingOperationStatus string
+
+const (
+	PendingOperationStatusPending  PendingOperationStatus = "pending"
+	PendingOperationStatusApproved PendingOperationStatus = "approved"
+	PendingOperationStatusRejected PendingOperationStatus = "rejected"
+)
+
+// PendingOperation is an operation that the safelist rejected and that waits for a review.
+type PendingOperation struct {
+	ID            string                 `db:"id"`
+	Body          string                 `db:"body"`
+	ClientName    string                 `db:"client_name"`
+	ClientVersion string                 `db:"client_version"`
+	Status        PendingOperationStatus `db:"status"`
+	FirstSeenAt   time.Time              `db:"first_seen_at"`
+	ReviewedAt    *time.Time             `db:"reviewed_at"`
+}
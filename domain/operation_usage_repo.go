@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func NewOperationUsageRepository(opts ...OperationUsageRepositoryOption) *OperationUsageRepository {
+	r := &OperationUsageRepository{
+		tracer: otel.GetTracerProvider().Tracer(pkgName + ".OperationUsageRepository"),
+	}
+	for _, o := range opts {
+		o.applyOperationUsageRepositoryOption(r)
+	}
+	r.tables.operationUsages = goqu.Dialect("postgres").From("persisted_operation_usages").Prepared(true)
+	return r
+}
+
+type OperationUsageRepository struct {
+	db *sqlx.DB
+
+	tracer trace.Tracer
+	tables struct{ operationUsages *goqu.SelectDataset }
+}
+
+func (r *OperationUsageRepository) RecordOperationUsages(ctx context.Context, usages []*OperationUsage) (err error) {
+	ctx, span := r.tracer.Start(ctx, "RecordOperationUsages", trace.WithAttributes(attribute.Int("app.operation_usage.count", len(usages))))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if len(usages) == 0 {
+		return nil
+	}
+	query, args, err := r.tables.operationUsages.Insert().Rows(usages).ToSQL()
+	if err != nil {
+		return &QueryBuildError{err}
+	}
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("ExecContext: %w", err)
+	}
+	return nil
+}
+
+// SummarizeOperationUsages sums up the usage recorded since the time per operation ID and client name.
+func (r *OperationUsageRepository) SummarizeOperationUsages(ctx context.Context, since time.Time) (_ []*OperationUsage, err error) {
+	ctx, span := r.tracer.Start(ctx, "SummarizeOperationUsages", trace.WithAttributes(attribute.String("app.operation_usage.since", since.Format(time.RFC3339))))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	query, args, err := r.tables.operationUsages.
+		Select(
+			goqu.C("operation_id"),
+			goqu.C("client_name"),
+			goqu.MAX("operation_name").As("operation_name"),
+			goqu.SUM("executions").As("executions"),
+			goqu.SUM("errors").As("errors"),
+			goqu.MAX("recorded_at").As("recorded_at"),
+		).
+		Where(goqu.C("recorded_at").Gte(since)).
+		GroupBy(goqu.C("operation_id"), goqu.C("client_name")).
+		Order(goqu.C("operation_id").Asc(), goqu.C("client_name").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, &QueryBuildError{err}
+	}
+	usages := make([]*OperationUsage, 0)
+	if err := r.db.SelectContext(ctx, &usages, query, args...); err != nil {
+		return nil, fmt.Errorf("SelectContext: %w", err)
+	}
+	return usages, nil
+}
@@ -4,12 +4,27 @@ import "github.com/jmoiron/sqlx"
 
 type DBOption interface {
 	CharacterRepositoryOption
+	PersistedOperationRepositoryOption
+	OperationUsageRepositoryOption
+	PendingOperationRepositoryOption
 }
 
 type CharacterRepositoryOption interface {
 	applyCharacterRepositoryOption(*CharacterRepository)
 }
 
+type PersistedOperationRepositoryOption interface {
+	applyPersistedOperationRepositoryOption(*PersistedOperationRepository)
+}
+
+type OperationUsageRepositoryOption interface {
+	applyOperationUsageRepositoryOption(*OperationUsageRepository)
+}
+
+type PendingOperationRepositoryOption interface {
+	applyPendingOperationRepositoryOption(*PendingOperationRepository)
+}
+
 type LimitOption interface {
 	SearchCharactersOption
 }
@@ -22,6 +37,14 @@ type withDBOpt struct{ db *sqlx.DB }
 
 func (o *withDBOpt) applyCharacterRepositoryOption(r *CharacterRepository) { r.db = o.db }
 
+func (o *withDBOpt) applyPersistedOperationRepositoryOption(r *PersistedOperationRepository) {
+	r.db = o.db
+}
+
+func (o *withDBOpt) applyOperationUsageRepositoryOption(r *OperationUsageRepository) { r.db = o.db }
+
+func (o *withDBOpt) applyPendingOperationRepositoryOption(r *PendingOperationRepository) { r.db = o.db }
+
 func WithDB(db *sqlx.DB) DBOption { return &withDBOpt{db} }
 
 type withLimitOpt struct{ limit uint }
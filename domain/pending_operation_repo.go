@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func NewPendingOperationRepository(opts ...PendingOperationRepositoryOption) *PendingOperationRepository {
+	r := &PendingOperationRepository{
+		tracer: otel.GetTracerProvider().Tracer(pkgName + ".PendingOperationRepository"),
+	}
+	for _, o := range opts {
+		o.applyPendingOperationRepositoryOption(r)
+	}
+	r.tables.pendingOperations = goqu.Dialect("postgres").From("pending_operations").Prepared(true)
+	return r
+}
+
+type PendingOperationRepository struct {
+	db *sqlx.DB
+
+	tracer trace.Tracer
+	tables struct{ pendingOperations *goqu.SelectDataset }
+}
+
+// CapturePendingOperation stores the operation unless it is already known, keeping the first seen time and the review result.
+func (r *PendingOperationRepository) CapturePendingOperation(ctx context.Context, op *PendingOperation) (err error) {
+	ctx, span := r.tracer.Start(ctx, "CapturePendingOperation", trace.WithAttributes(attribute.String("app.pending_operation.id", op.ID)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	record := goqu.Record{
+		"id":             op.ID,
+		"body":           op.Body,
+		"client_name":    op.ClientName,
+		"client_version": op.ClientVersion,
+	}
+	query, args, err := r.tables.pendingOperations.
+		Insert().
+		Rows(record).
+		OnConflict(goqu.DoNothing()).
+		ToSQL()
+	if err != nil {
+		return &QueryBuildError{err}
+	}
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("ExecContext: %w", err)
+	}
+	return nil
+}
+
+func (r *PendingOperationRepository) FindPendingOperationByID(ctx context.Context, id string) (_ *PendingOperation, err error) {
+	ctx, span := r.tracer.Start(ctx, "FindPendingOperationByID", trace.WithAttributes(attribute.String("app.pending_operation.id", id)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	query, args, err := r.tables.pendingOperations.Where(goqu.C("id").Eq(id)).Limit(1).ToSQL()
+	if err != nil {
+		return nil, &QueryBuildError{err}
+	}
+	op := new(PendingOperation)
+	if err := r.db.GetContext(ctx, op, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError[string, *PendingOperation]{Key: id}
+		}
+		return nil, err
+	}
+	return op, nil
+}
+
+func (r *PendingOperationRepository) ListPendingOperations(ctx context.Context, status PendingOperationStatus) (_ []*PendingOperation, err error) {
+	ctx, span := r.tracer.Start(ctx, "ListPendingOperations", trace.WithAttributes(attribute.String("app.pending_operation.status", string(status))))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	query, args, err := r.tables.pendingOperations.
+		Where(goqu.C("status").Eq(status)).
+		Order(goqu.C("first_seen_at").Asc(), goqu.C("id").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, &QueryBuildError{err}
+	}
+	ops := make([]*PendingOperation, 0)
+	if err := r.db.SelectContext(ctx, &ops, query, args...); err != nil {
+		return nil, fmt.Errorf("SelectContext: %w", err)
+	}
+	return ops, nil
+}
+
+// ReviewPendingOperation sets the review result of the operation that is still pending.
+func (r *PendingOperationRepository) ReviewPendingOperation(ctx context.Context, id string, status PendingOperationStatus) (_ *PendingOperation, err error) {
+	ctx, span := r.tracer.Start(ctx, "ReviewPendingOperation", trace.WithAttributes(attribute.String("app.pending_operation.id", id), attribute.String("app.pending_operation.status", string(status))))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	query, args, err := r.tables.pendingOperations.
+		Update().
+		Set(goqu.Record{"status": status, "reviewed_at": goqu.L("current_timestamp")}).
+		Where(goqu.C("id").Eq(id), goqu.C("status").Eq(PendingOperationStatusPending)).
+		Returning(goqu.Star()).
+		ToSQL()
+	if err != nil {
+		return nil, &QueryBuildError{err}
+	}
+	reviewed := new(PendingOperation)
+	if err := r.db.GetContext(ctx, reviewed, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError[string, *PendingOperation]{Key: id}
+		}
+		return nil, fmt.Errorf("GetContext: %w", err)
+	}
+	return reviewed, nil
+}
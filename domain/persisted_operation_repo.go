@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func NewPersistedOperationRepository(opts ...PersistedOperationRepositoryOption) *PersistedOperationRepository {
+	r := &PersistedOperationRepository{
+		tracer: otel.GetTracerProvider().Tracer(pkgName + ".PersistedOperationRepository"),
+	}
+	for _, o := range opts {
+		o.applyPersistedOperationRepositoryOption(r)
+	}
+	r.tables.persistedOperations = goqu.Dialect("postgres").From("persisted_operations").Prepared(true)
+	return r
+}
+
+type PersistedOperationRepository struct {
+	db *sqlx.DB
+
+	tracer trace.Tracer
+	tables struct{ persistedOperations *goqu.SelectDataset }
+}
+
+func (r *PersistedOperationRepository) FindPersistedOperationByID(ctx context.Context, id string) (_ *PersistedOperation, err error) {
+	ctx, span := r.tracer.Start(ctx, "FindPersistedOperationByID", trace.WithAttributes(attribute.String("app.persisted_operation.id", id)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	query, args, err := r.tables.persistedOperations.Where(goqu.C("id").Eq(id), goqu.C("retired_at").IsNull()).Limit(1).ToSQL()
+	if err != nil {
+		return nil, &QueryBuildError{err}
+	}
+	op := new(PersistedOperation)
+	if err := r.db.GetContext(ctx, op, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError[string, *PersistedOperation]{Key: id}
+		}
+		return nil, err
+	}
+	return op, nil
+}
+
+func (r *PersistedOperationRepository) ListPersistedOperations(ctx context.Context) (_ []*PersistedOperation, err error) {
+	ctx, span := r.tracer.Start(ctx, "ListPersistedOperations")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	query, args, err := r.tables.persistedOperations.Order(goqu.C("created_at").Asc(), goqu.C("id").Asc()).ToSQL()
+	if err != nil {
+		return nil, &QueryBuildError{err}
+	}
+	ops := make([]*PersistedOperation, 0)
+	if err := r.db.SelectContext(ctx, &ops, query, args...); err != nil {
+		return nil, fmt.Errorf("SelectContext: %w", err)
+	}
+	return ops, nil
+}
+
+// RegisterPersistedOperation stores the operation. Registering a retired operation again brings it back.
+func (r *PersistedOperationRepository) RegisterPersistedOperation(ctx context.Context, op *PersistedOperation) (_ *PersistedOperation, err error) {
+	ctx, span := r.tracer.Start(ctx, "RegisterPersistedOperation", trace.WithAttributes(attribute.String("app.persisted_operation.id", op.ID)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	record := goqu.Record{
+		"id":             op.ID,
+		"name":           op.Name,
+		"type":           op.Type,
+		"body":           op.Body,
+		"client_name":    op.ClientName,
+		"client_version": op.ClientVersion,
+	}
+	query, args, err := r.tables.persistedOperations.
+		Insert().
+		Rows(record).
+		OnConflict(goqu.DoUpdate("id", goqu.Record{"retired_at": nil, "client_name": op.ClientName, "client_version": op.ClientVersion})).
+		Returning(goqu.Star()).
+		ToSQL()
+	if err != nil {
+		return nil, &QueryBuildError{err}
+	}
+	registered := new(PersistedOperation)
+	if err := r.db.GetContext(ctx, registered, query, args...); err != nil {
+		return nil, fmt.Errorf("GetContext: %w", err)
+	}
+	return registered, nil
+}
+
+func (r *PersistedOperationRepository) RetirePersistedOperation(ctx context.Context, id string) (_ *PersistedOperation, err error) {
+	ctx, span := r.tracer.Start(ctx, "RetirePersistedOperation", trace.WithAttributes(attribute.String("app.persisted_operation.id", id)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	query, args, err := r.tables.persistedOperations.
+		Update().
+		Set(goqu.Record{"retired_at": goqu.L("current_timestamp")}).
+		Where(goqu.C("id").Eq(id), goqu.C("retired_at").IsNull()).
+		Returning(goqu.Star()).
+		ToSQL()
+	if err != nil {
+		return nil, &QueryBuildError{err}
+	}
+	retired := new(PersistedOperation)
+	if err := r.db.GetContext(ctx, retired, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &NotFoundError[string, *PersistedOperation]{Key: id}
+		}
+		return nil, fmt.Errorf("GetContext: %w", err)
+	}
+	return retired, nil
+}
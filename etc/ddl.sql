@@ -14,3 +14,39 @@ create table characters (
 );
 
 create unique index on characters (name);
+
+create table persisted_operations (
+  id varchar(255) primary key,
+  name varchar(255) not null,
+  type varchar(32) not null,
+  body text not null,
+  client_name varchar(255) not null default '',
+  client_version varchar(255) not null default '',
+  created_at timestamptz not null default current_timestamp,
+  retired_at timestamptz
+);
+
+create table persisted_operation_usages (
+  id serial primary key,
+  operation_id varchar(255) not null,
+  operation_name varchar(255) not null,
+  client_name varchar(255) not null,
+  executions bigint not null,
+  errors bigint not null,
+  latency_p50_ms real not null,
+  latency_p90_ms real not null,
+  latency_p99_ms real not null,
+  recorded_at timestamptz not null default current_timestamp
+);
+
+create index on persisted_operation_usages (operation_id, recorded_at);
+
+create table pending_operations (
+  id varchar(255) primary key,
+  body text not null,
+  client_name varchar(255) not null default '',
+  client_version varchar(255) not null default '',
+  status varchar(16) not null default 'pending',
+  first_seen_at timestamptz not null default current_timestamp,
+  reviewed_at timestamptz
+);
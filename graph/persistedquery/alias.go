@@ -0,0 +1,94 @@
+package persistedquery
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AliasLookup is implemented by caches that redirect retired operation IDs to replacement operations.
+type AliasLookup interface {
+	LookupAlias(ctx context.Context, id string) (*apollo.Alias, bool)
+}
+
+func lookupAlias(ctx context.Context, cache graphql.Cache, id string) (*apollo.Alias, bool) {
+	l, ok := cache.(AliasLookup)
+	if !ok {
+		return nil, false
+	}
+	return l.LookupAlias(ctx, id)
+}
+
+// AliasVariables is a handler extension that transforms the variables of the requests for aliased operations.
+//
+// It must be used after the extension that resolves the persisted query such as Safelist, and before VariableConstraints.
+type AliasVariables struct {
+	Cache graphql.Cache
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+} = AliasVariables{}
+
+func (AliasVariables) ExtensionName() string { return "PersistedQueryAliasVariables" }
+
+func (a AliasVariables) Validate(graphql.ExecutableSchema) error {
+	if a.Cache == nil {
+		return ErrNilCache
+	}
+	return nil
+}
+
+func (a AliasVariables) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	alias, ok := lookupAlias(ctx, a.Cache, persistedQueryID(ctx))
+	if !ok {
+		return nil
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("graphql.persisted_query.alias_of", alias.Target))
+	if alias.Variables != nil {
+		rawParams.Variables = alias.Variables.Apply(rawParams.Variables)
+	}
+	return nil
+}
+
+// AliasedQuery is a handler extension that drops the retired body sent along with an alias ID,
+// so that the extension resolving the persisted query runs the replacement operation instead.
+//
+// It must be used before AutomaticPersistedQuery, which would otherwise run the sent body as is.
+type AliasedQuery struct {
+	Cache graphql.Cache
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+} = AliasedQuery{}
+
+func (AliasedQuery) ExtensionName() string { return "PersistedQueryAliasedQuery" }
+
+func (a AliasedQuery) Validate(graphql.ExecutableSchema) error {
+	if a.Cache == nil {
+		return ErrNilCache
+	}
+	return nil
+}
+
+func (a AliasedQuery) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	if rawParams.Query == "" {
+		return nil
+	}
+	ext, ok := rawParams.Extensions["persistedQuery"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	hash, _ := ext["sha256Hash"].(string)
+	if hash != "" && isAliasedQuery(ctx, a.Cache, hash, rawParams.Query) {
+		rawParams.Query = ""
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package apollo
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrEmptyAliasID       = errors.New("alias id is empty")
+	ErrUnknownAliasTarget = errors.New("alias target is not an operation in the manifest")
+	ErrDuplicateAliasID   = errors.New("alias id is duplicated or used by an operation")
+)
+
+// Alias redirects a retired operation ID to the replacement operation in the same manifest.
+type Alias struct {
+	ID        string             `json:"id"`
+	Target    string             `json:"target"`
+	Variables *VariableTransform `json:"variables,omitempty"`
+}
+
+// VariableTransform converts the variables sent for the retired operation into the ones of the replacement.
+//
+// Rename is applied first, then Drop and Set.
+type VariableTransform struct {
+	// Rename maps the old variable names to the new ones.
+	Rename map[string]string `json:"rename,omitempty"`
+	Drop   []string          `json:"drop,omitempty"`
+	// Set adds the variables or overwrites the values sent by clients.
+	Set map[string]any `json:"set,omitempty"`
+}
+
+// Apply returns the transformed variables without modifying the given ones.
+func (t *VariableTransform) Apply(vars map[string]any) map[string]any {
+	transformed := make(map[string]any, len(vars)+len(t.Set))
+	for name, value := range vars {
+		if renamed, ok := t.Rename[name]; ok {
+			name = renamed
+		}
+		transformed[name] = value
+	}
+	for _, name := range t.Drop {
+		delete(transformed, name)
+	}
+	for name, value := range t.Set {
+		transformed[name] = value
+	}
+	return transformed
+}
+
+func validateAliases(aliases []Alias, ops []Operation) error {
+	opIDs := make(map[string]struct{}, len(ops))
+	for _, op := range ops {
+		opIDs[op.ID] = struct{}{}
+	}
+	var err error
+	seen := make(map[string]struct{}, len(aliases))
+	for i, alias := range aliases {
+		var aliasErr error
+		if alias.ID == "" {
+			aliasErr = errors.Join(aliasErr, ErrEmptyAliasID)
+		}
+		if _, ok := opIDs[alias.Target]; !ok {
+			aliasErr = errors.Join(aliasErr, ErrUnknownAliasTarget)
+		}
+		_, dupAlias := seen[alias.ID]
+		_, dupOp := opIDs[alias.ID]
+		if dupAlias || dupOp {
+			aliasErr = errors.Join(aliasErr, ErrDuplicateAliasID)
+		}
+		seen[alias.ID] = struct{}{}
+		if aliasErr != nil {
+			err = errors.Join(err, &InvalidAliasError{Index: i, ID: alias.ID, Err: aliasErr})
+		}
+	}
+	return err
+}
+
+type InvalidAliasError struct {
+	Index int
+	ID    string
+	Err   error
+}
+
+func (e *InvalidAliasError) Error() string {
+	return fmt.Sprintf("aliases[%d] (id=%q): %s", e.Index, e.ID, e.Err)
+}
+
+func (e *InvalidAliasError) Unwrap() error { return e.Err }
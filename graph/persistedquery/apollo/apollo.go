@@ -2,38 +2,195 @@ package apollo
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 
 	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
 )
 
-type queryList map[string]string
+const (
+	SupportedFormat  = "apollo-persisted-query-manifest"
+	SupportedVersion = 1
+)
+
+var (
+	ErrNoOperations       = errors.New("manifest has no operations")
+	ErrEmptyOperationID   = errors.New("operation id is empty")
+	ErrEmptyBody          = errors.New("operation body is empty")
+	ErrIDMismatch         = errors.New("operation id does not match the SHA-256 hash of the body")
+	ErrDuplicateID        = errors.New("operation id is duplicated")
+	ErrDuplicateName      = errors.New("operation name is duplicated")
+	ErrUnsupportedFormat  = errors.New("unsupported manifest format")
+	ErrUnsupportedVersion = errors.New("unsupported manifest version")
+)
 
+type queryList struct {
+	operations map[string]*Operation
+	aliases    map[string]*Alias
+}
+
+// New returns the query list of the manifest. The IDs of aliases resolve to their target operations.
 func New(manifest *Manifest) graphql.Cache {
-	list := make(queryList)
-	for _, op := range manifest.Operations {
-		list[op.ID] = op.Body
+	list := &queryList{
+		operations: make(map[string]*Operation, len(manifest.Operations)+len(manifest.Aliases)),
+		aliases:    make(map[string]*Alias, len(manifest.Aliases)),
+	}
+	for i := range manifest.Operations {
+		op := manifest.Operations[i]
+		list.operations[op.ID] = &op
+	}
+	for i := range manifest.Aliases {
+		alias := manifest.Aliases[i]
+		if target, ok := list.operations[alias.Target]; ok {
+			list.aliases[alias.ID] = &alias
+			list.operations[alias.ID] = target
+		}
 	}
 	return list
 }
 
-var _ graphql.Cache = (queryList)(nil)
+var _ graphql.Cache = (*queryList)(nil)
 
-func (l queryList) Get(_ context.Context, hash string) (any, bool) {
-	query, ok := l[hash]
-	return query, ok
+func (l *queryList) Get(_ context.Context, hash string) (any, bool) {
+	op, ok := l.operations[hash]
+	if !ok {
+		return nil, false
+	}
+	return op.Body, true
 }
 
-func (queryList) Add(context.Context, string, any) {}
+func (*queryList) Add(context.Context, string, any) {}
+
+// LookupOperation returns the whole operation including its metadata.
+func (l *queryList) LookupOperation(_ context.Context, hash string) (*Operation, bool) {
+	op, ok := l.operations[hash]
+	return op, ok
+}
+
+// LookupAlias returns the alias if the hash is the ID of an alias.
+func (l *queryList) LookupAlias(_ context.Context, hash string) (*Alias, bool) {
+	alias, ok := l.aliases[hash]
+	return alias, ok
+}
 
 type Manifest struct {
 	Format     string      `json:"format"`
 	Version    int         `json:"version"`
 	Operations []Operation `json:"operations"`
+	Aliases    []Alias     `json:"aliases,omitempty"`
+}
+
+func (m *Manifest) Validate() error {
+	var err error
+	if m.Format != SupportedFormat {
+		err = errors.Join(err, fmt.Errorf("%w: %q", ErrUnsupportedFormat, m.Format))
+	}
+	if m.Version != SupportedVersion {
+		err = errors.Join(err, fmt.Errorf("%w: %d", ErrUnsupportedVersion, m.Version))
+	}
+	return errors.Join(err, ValidateOperations(m.Operations), validateAliases(m.Aliases, m.Operations))
+}
+
+type validateConfig struct {
+	skipIDVerification bool
+}
+
+type ValidateOption func(*validateConfig)
+
+// WithoutIDVerification skips comparing operation IDs with the hash of their bodies.
+// It is meant for manifest formats whose IDs are not SHA-256 hashes.
+func WithoutIDVerification() ValidateOption {
+	return func(c *validateConfig) { c.skipIDVerification = true }
+}
+
+// ValidateOperations checks each operation and reports every invalid one.
+func ValidateOperations(ops []Operation, opts ...ValidateOption) error {
+	var cfg validateConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if len(ops) == 0 {
+		return ErrNoOperations
+	}
+	var err error
+	seenIDs := make(map[string]struct{}, len(ops))
+	seenNames := make(map[string]struct{}, len(ops))
+	for i, op := range ops {
+		opErr := op.validate()
+		if !cfg.skipIDVerification && op.ID != "" && op.Body != "" && op.ID != ComputeID(op.Body) {
+			opErr = errors.Join(opErr, ErrIDMismatch)
+		}
+		if _, ok := seenIDs[op.ID]; ok {
+			opErr = errors.Join(opErr, ErrDuplicateID)
+		}
+		seenIDs[op.ID] = struct{}{}
+		if op.Name != "" {
+			if _, ok := seenNames[op.Name]; ok {
+				opErr = errors.Join(opErr, ErrDuplicateName)
+			}
+			seenNames[op.Name] = struct{}{}
+		}
+		if opErr != nil {
+			err = errors.Join(err, &InvalidOperationError{Index: i, ID: op.ID, Name: op.Name, Err: opErr})
+		}
+	}
+	return err
 }
 
 type Operation struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Type string `json:"type"`
-	Body string `json:"body"`
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Type   string  `json:"type"`
+	Body   string  `json:"body"`
+	Policy *Policy `json:"policy,omitempty"`
+	// Variables constrains the variables that clients can pass, keyed by the variable name without "$".
+	Variables map[string]VariableConstraint `json:"variables,omitempty"`
+}
+
+func (op Operation) validate() error {
+	var err error
+	if op.ID == "" {
+		err = errors.Join(err, ErrEmptyOperationID)
+	}
+	if op.Body == "" {
+		err = errors.Join(err, ErrEmptyBody)
+	}
+	return err
+}
+
+// NewOperation builds an operation from the body, taking the name and the type from its first operation definition.
+func NewOperation(id, body string) (Operation, error) {
+	doc, err := parser.ParseQuery(&ast.Source{Input: body})
+	if err != nil {
+		return Operation{}, fmt.Errorf("failed to parse operation %q: %w", id, err)
+	}
+	op := Operation{ID: id, Body: body}
+	if len(doc.Operations) > 0 {
+		op.Name = doc.Operations[0].Name
+		op.Type = string(doc.Operations[0].Operation)
+	}
+	return op, nil
+}
+
+// ComputeID returns the operation ID for the body, which is the hex encoded SHA-256 hash.
+func ComputeID(body string) string {
+	h := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(h[:])
 }
+
+type InvalidOperationError struct {
+	Index int
+	ID    string
+	Name  string
+	Err   error
+}
+
+func (e *InvalidOperationError) Error() string {
+	return fmt.Sprintf("operations[%d] (id=%q name=%q): %s", e.Index, e.ID, e.Name, e.Err)
+}
+
+func (e *InvalidOperationError) Unwrap() error { return e.Err }
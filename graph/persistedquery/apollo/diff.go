@@ -0,0 +1,85 @@
+package apollo
+
+import "sort"
+
+// Diff is the difference between two manifests.
+//
+// Operations are matched by ID. A removed and an added operation sharing a name are reported as Changed instead.
+type Diff struct {
+	Added          []Operation `json:"added"`
+	Removed        []Operation `json:"removed"`
+	Changed        []Change    `json:"changed"`
+	AddedAliases   []Alias     `json:"addedAliases"`
+	RemovedAliases []Alias     `json:"removedAliases"`
+}
+
+type Change struct {
+	Name string    `json:"name"`
+	Old  Operation `json:"old"`
+	New  Operation `json:"new"`
+}
+
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.AddedAliases) == 0 && len(d.RemovedAliases) == 0
+}
+
+func Compare(oldManifest, newManifest *Manifest) *Diff {
+	oldByID := indexByID(oldManifest.Operations)
+	newByID := indexByID(newManifest.Operations)
+	added := make(map[string]Operation)
+	for id, op := range newByID {
+		if _, ok := oldByID[id]; !ok && op.Name != "" {
+			added[op.Name] = op
+		}
+	}
+	diff := &Diff{Added: []Operation{}, Removed: []Operation{}, Changed: []Change{}, AddedAliases: []Alias{}, RemovedAliases: []Alias{}}
+	for _, op := range oldManifest.Operations {
+		if _, ok := newByID[op.ID]; ok {
+			continue
+		}
+		if replacement, ok := added[op.Name]; ok && op.Name != "" {
+			diff.Changed = append(diff.Changed, Change{Name: op.Name, Old: op, New: replacement})
+			delete(added, op.Name)
+			continue
+		}
+		diff.Removed = append(diff.Removed, op)
+	}
+	for _, op := range newManifest.Operations {
+		if _, ok := oldByID[op.ID]; ok {
+			continue
+		}
+		if _, ok := added[op.Name]; ok || op.Name == "" {
+			diff.Added = append(diff.Added, op)
+		}
+	}
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Name < diff.Changed[j].Name })
+	oldAliases := indexAliases(oldManifest.Aliases)
+	newAliases := indexAliases(newManifest.Aliases)
+	for _, alias := range oldManifest.Aliases {
+		if _, ok := newAliases[alias.ID]; !ok {
+			diff.RemovedAliases = append(diff.RemovedAliases, alias)
+		}
+	}
+	for _, alias := range newManifest.Aliases {
+		if _, ok := oldAliases[alias.ID]; !ok {
+			diff.AddedAliases = append(diff.AddedAliases, alias)
+		}
+	}
+	return diff
+}
+
+func indexAliases(aliases []Alias) map[string]Alias {
+	index := make(map[string]Alias, len(aliases))
+	for _, alias := range aliases {
+		index[alias.ID] = alias
+	}
+	return index
+}
+
+func indexByID(ops []Operation) map[string]Operation {
+	index := make(map[string]Operation, len(ops))
+	for _, op := range ops {
+		index[op.ID] = op
+	}
+	return index
+}
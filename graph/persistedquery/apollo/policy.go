@@ -0,0 +1,47 @@
+package apollo
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Policy is the execution policy of an operation declared in the manifest.
+type Policy struct {
+	// MaxExecutionTime cancels the execution of the operation when it takes longer.
+	MaxExecutionTime Duration `json:"maxExecutionTime,omitempty"`
+	// CacheTTL is used as max-age of Cache-Control for the responses of the operation.
+	CacheTTL Duration `json:"cacheTTL,omitempty"`
+	// RateLimitClass names the rate limit shared by the operations of the same class.
+	RateLimitClass string `json:"rateLimitClass,omitempty"`
+	Deprecated     bool   `json:"deprecated,omitempty"`
+	// DeprecatedAt is the time when the operation is or will be deprecated. It implies Deprecated.
+	DeprecatedAt *time.Time `json:"deprecatedAt,omitempty"`
+	// Sunset is the time after which the operation is refused. It implies Deprecated.
+	Sunset *time.Time `json:"sunset,omitempty"`
+}
+
+func (p *Policy) IsDeprecated() bool { return p.Deprecated || p.DeprecatedAt != nil || p.Sunset != nil }
+
+// Duration is a time.Duration encoded as a string such as "1.5s" in JSON.
+type Duration time.Duration
+
+var (
+	_ json.Marshaler   = Duration(0)
+	_ json.Unmarshaler = (*Duration)(nil)
+)
+
+func (d Duration) MarshalJSON() ([]byte, error) { return json.Marshal(time.Duration(d).String()) }
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
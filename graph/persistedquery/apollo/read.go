@@ -0,0 +1,34 @@
+package apollo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+func Decode(r io.Reader) (*Manifest, error) {
+	var manifest Manifest
+	dec := json.NewDecoder(r)
+	dec.UseNumber() // keep the values of variable constraints as they are sent by clients
+	if err := dec.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// Detect reports whether the data looks like an Apollo persisted query manifest.
+func Detect(data []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	_, hasFormat := fields["format"]
+	_, hasOperations := fields["operations"]
+	return hasFormat && hasOperations
+}
+
+func DecodeBytes(data []byte) (*Manifest, error) { return Decode(bytes.NewReader(data)) }
@@ -0,0 +1,14 @@
+package apollo
+
+// VariableConstraint restricts the value of a variable of an operation.
+type VariableConstraint struct {
+	// Fixed is the only value allowed. It is also used when the client omits the variable.
+	Fixed any `json:"fixed,omitempty"`
+	// Default is used when the client omits the variable.
+	Default any `json:"default,omitempty"`
+	// Min and Max are the inclusive bounds of a numeric variable.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// OneOf lists the allowed values such as enum values.
+	OneOf []any `json:"oneOf,omitempty"`
+}
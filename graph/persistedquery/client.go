@@ -0,0 +1,38 @@
+package persistedquery
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	HeaderClientName    = "apollographql-client-name"
+	HeaderClientVersion = "apollographql-client-version"
+)
+
+type ClientInfo struct {
+	Name    string
+	Version string
+}
+
+func ClientInfoFromHeader(h http.Header) ClientInfo {
+	return ClientInfo{Name: h.Get(HeaderClientName), Version: h.Get(HeaderClientVersion)}
+}
+
+type clientInfoCtxKey struct{}
+
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoCtxKey{}, info)
+}
+
+func ClientInfoFromContext(ctx context.Context) (ClientInfo, bool) {
+	info, ok := ctx.Value(clientInfoCtxKey{}).(ClientInfo)
+	return info, ok
+}
+
+// ClientInfoMiddleware puts the client identification headers into the request context so that caches can see them.
+func ClientInfoMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithClientInfo(r.Context(), ClientInfoFromHeader(r.Header))))
+	})
+}
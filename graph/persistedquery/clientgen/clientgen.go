@@ -0,0 +1,274 @@
+// Package clientgen generates a typed Go client of the persisted operations.
+package clientgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const defaultPackageName = "pqclient"
+
+var defaultScalars = map[string]string{
+	"ID":          "string",
+	"String":      "string",
+	"Int":         "int",
+	"Float":       "float64",
+	"Boolean":     "bool",
+	"UnsignedInt": "uint",
+	"Numeric":     "float64",
+}
+
+type config struct {
+	packageName string
+	scalars     map[string]string
+}
+
+type Option func(*config)
+
+func WithPackageName(name string) Option { return func(c *config) { c.packageName = name } }
+
+// WithScalar maps the GraphQL scalar to the Go type. Scalars without mapping are decoded as json.RawMessage.
+func WithScalar(name, goType string) Option { return func(c *config) { c.scalars[name] = goType } }
+
+// Generate returns the gofmt-ed source of the client package for the operations in the manifest.
+//
+// Object types are shared by the operations, so only the fields selected by an operation are populated in its result.
+// Subscriptions and aliases in nested selections are not supported.
+func Generate(schema *ast.Schema, manifest *apollo.Manifest, opts ...Option) ([]byte, error) {
+	cfg := &config{packageName: defaultPackageName, scalars: make(map[string]string, len(defaultScalars))}
+	for name, goType := range defaultScalars {
+		cfg.scalars[name] = goType
+	}
+	for _, o := range opts {
+		o(cfg)
+	}
+	g := &generator{cfg: cfg, schema: schema, types: make(map[string]bool)}
+	ops := make([]apollo.Operation, len(manifest.Operations))
+	copy(ops, manifest.Operations)
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Name < ops[j].Name })
+	for _, op := range ops {
+		if err := g.operation(op); err != nil {
+			return nil, fmt.Errorf("operation %s (%s): %w", op.Name, op.ID, err)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by generate_client; DO NOT EDIT.\n\npackage %s\n\n", cfg.packageName)
+	out.WriteString(runtime)
+	names := make([]string, 0, len(g.types))
+	for name := range g.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g.typeDecl(&out, schema.Types[name])
+	}
+	out.Write(g.ops.Bytes())
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return src, nil
+}
+
+type generator struct {
+	cfg    *config
+	schema *ast.Schema
+	// types are the names of the enum, input and object types used by the operations.
+	types map[string]bool
+	ops   bytes.Buffer
+}
+
+func (g *generator) operation(op apollo.Operation) error {
+	if op.Name == "" {
+		return fmt.Errorf("anonymous operation is not supported")
+	}
+	doc, errs := gqlparser.LoadQuery(g.schema, op.Body)
+	if len(errs) > 0 {
+		return errs
+	}
+	definition := doc.Operations.ForName(op.Name)
+	if definition == nil {
+		return fmt.Errorf("document has no operation named %s", op.Name)
+	}
+	if definition.Operation == ast.Subscription {
+		return fmt.Errorf("subscription is not supported")
+	}
+	name := exportedName(op.Name)
+
+	fields, err := g.collectFields(definition.SelectionSet, true)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(&g.ops, "// %sResult is the data of the %s operation.\ntype %sResult struct {\n", name, op.Name, name)
+	for _, f := range fields {
+		fmt.Fprintf(&g.ops, "\t%s %s `json:%q`\n", exportedName(f.key), g.goType(f.typ), f.key)
+	}
+	g.ops.WriteString("}\n\n")
+
+	varsParam, varsArg := "", "nil"
+	if len(definition.VariableDefinitions) > 0 {
+		fmt.Fprintf(&g.ops, "type %sVariables struct {\n", name)
+		for _, v := range definition.VariableDefinitions {
+			fmt.Fprintf(&g.ops, "\t%s %s `json:%q`\n", exportedName(v.Variable), g.goType(v.Type), jsonTag(v.Variable, v.Type))
+			g.useType(v.Type)
+		}
+		g.ops.WriteString("}\n\n")
+		varsParam, varsArg = fmt.Sprintf(", variables %sVariables", name), "variables"
+	}
+	fmt.Fprintf(&g.ops, "const %sID = %q\n\n", unexportedName(op.Name), op.ID)
+	fmt.Fprintf(&g.ops, "// %s runs the persisted operation %s.\n", name, op.Name)
+	fmt.Fprintf(&g.ops, "// The result is returned along with *ResponseError if the response has both data and errors.\n")
+	fmt.Fprintf(&g.ops, "func (c *Client) %s(ctx context.Context%s) (*%sResult, error) {\n", name, varsParam, name)
+	fmt.Fprintf(&g.ops, "\tresult := new(%sResult)\n", name)
+	fmt.Fprintf(&g.ops, "\tif err := c.do(ctx, %q, %sID, %s, result); err != nil {\n", op.Name, unexportedName(op.Name), varsArg)
+	fmt.Fprintf(&g.ops, "\t\treturn result, err\n\t}\n\treturn result, nil\n}\n\n")
+	return nil
+}
+
+type field struct {
+	key string
+	typ *ast.Type
+}
+
+// collectFields flattens the fragments in the selection set. Aliases are allowed only at the top level.
+func (g *generator) collectFields(set ast.SelectionSet, topLevel bool) ([]field, error) {
+	fields := make([]field, 0, len(set))
+	seen := make(map[string]bool)
+	var walk func(ast.SelectionSet) error
+	walk = func(set ast.SelectionSet) error {
+		for _, sel := range set {
+			switch sel := sel.(type) {
+			case *ast.Field:
+				if sel.Name == "__typename" {
+					continue
+				}
+				if sel.Alias != sel.Name && !topLevel {
+					return fmt.Errorf("alias %s in nested selection is not supported", sel.Alias)
+				}
+				if len(sel.SelectionSet) > 0 {
+					if _, err := g.collectFields(sel.SelectionSet, false); err != nil {
+						return err
+					}
+				}
+				g.useType(sel.Definition.Type)
+				if !seen[sel.Alias] {
+					seen[sel.Alias] = true
+					fields = append(fields, field{key: sel.Alias, typ: sel.Definition.Type})
+				}
+			case *ast.InlineFragment:
+				if err := walk(sel.SelectionSet); err != nil {
+					return err
+				}
+			case *ast.FragmentSpread:
+				if err := walk(sel.Definition.SelectionSet); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(set); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// useType marks the named type and the types of its fields to be declared.
+func (g *generator) useType(t *ast.Type) {
+	for t.Elem != nil {
+		t = t.Elem
+	}
+	def := g.schema.Types[t.NamedType]
+	if def == nil || def.Kind == ast.Scalar || g.types[def.Name] {
+		return
+	}
+	g.types[def.Name] = true
+	for _, f := range def.Fields {
+		if !strings.HasPrefix(f.Name, "__") {
+			g.useType(f.Type)
+		}
+	}
+}
+
+func (g *generator) typeDecl(out *bytes.Buffer, def *ast.Definition) {
+	switch def.Kind {
+	case ast.Enum:
+		fmt.Fprintf(out, "type %s string\n\nconst (\n", def.Name)
+		for _, v := range def.EnumValues {
+			fmt.Fprintf(out, "\t%s%s %s = %q\n", def.Name, enumValueName(v.Name), def.Name, v.Name)
+		}
+		out.WriteString(")\n\n")
+	case ast.InputObject:
+		fmt.Fprintf(out, "type %s struct {\n", def.Name)
+		for _, f := range def.Fields {
+			fmt.Fprintf(out, "\t%s %s `json:%q`\n", exportedName(f.Name), g.goType(f.Type), jsonTag(f.Name, f.Type))
+		}
+		out.WriteString("}\n\n")
+	case ast.Object, ast.Interface:
+		fmt.Fprintf(out, "type %s struct {\n", def.Name)
+		for _, f := range def.Fields {
+			if strings.HasPrefix(f.Name, "__") {
+				continue
+			}
+			fmt.Fprintf(out, "\t%s %s `json:%q`\n", exportedName(f.Name), g.goType(f.Type), f.Name)
+		}
+		out.WriteString("}\n\n")
+	}
+}
+
+func (g *generator) goType(t *ast.Type) string {
+	if t.Elem != nil {
+		return "[]" + g.goType(t.Elem)
+	}
+	name := t.NamedType
+	def := g.schema.Types[name]
+	if def != nil && def.Kind == ast.Scalar {
+		goType, ok := g.cfg.scalars[name]
+		if !ok {
+			return "json.RawMessage"
+		}
+		name = goType
+	}
+	if !t.NonNull {
+		return "*" + name
+	}
+	return name
+}
+
+func jsonTag(name string, t *ast.Type) string {
+	if t.NonNull {
+		return name
+	}
+	return name + ",omitempty"
+}
+
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func unexportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// enumValueName converts SCREAMING_SNAKE_CASE to CamelCase.
+func enumValueName(value string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(strings.ToLower(value), "_") {
+		b.WriteString(exportedName(part))
+	}
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package clientgen
+
+// runtime is the part of the generated package that does not depend on the operations.
+const runtime = `import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Client calls the persisted operations by their IDs. It never sends the query bodies.
+type Client struct {
+	endpoint      string
+	httpClient    *http.Client
+	clientName    string
+	clientVersion string
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithClientInfo sends the client name and version, which the server uses to pick the operations and to record the usage.
+func WithClientInfo(name, version string) Option {
+	return func(c *Client) {
+		c.clientName = name
+		c.clientVersion = version
+	}
+}
+
+// New returns the client of the public GraphQL endpoint such as "https://example.com/public/graphql".
+func New(endpoint string, opts ...Option) *Client {
+	c := &Client{endpoint: endpoint, httpClient: http.DefaultClient}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+type GraphQLError struct {
+	Message    string         ` + "`json:\"message\"`" + `
+	Path       []any          ` + "`json:\"path,omitempty\"`" + `
+	Extensions map[string]any ` + "`json:\"extensions,omitempty\"`" + `
+}
+
+// ResponseError is returned when the response has errors.
+type ResponseError struct {
+	StatusCode int
+	Errors     []GraphQLError
+}
+
+func (e *ResponseError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Message
+	}
+	return fmt.Sprintf("graphql: %s", strings.Join(msgs, "; "))
+}
+
+func (c *Client) do(ctx context.Context, operationName, id string, variables any, data any) error {
+	payload := map[string]any{
+		"operationName": operationName,
+		"extensions":    map[string]any{"persistedQuery": map[string]any{"version": 1, "sha256Hash": id}},
+	}
+	if variables != nil {
+		payload["variables"] = variables
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.clientName != "" {
+		req.Header.Set("apollographql-client-name", c.clientName)
+	}
+	if c.clientVersion != "" {
+		req.Header.Set("apollographql-client-version", c.clientVersion)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Data   json.RawMessage ` + "`json:\"data\"`" + `
+		Errors []GraphQLError  ` + "`json:\"errors\"`" + `
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("failed to decode response (status %d): %w", resp.StatusCode, err)
+	}
+	if len(out.Data) > 0 && string(out.Data) != "null" {
+		if err := json.Unmarshal(out.Data, data); err != nil {
+			return fmt.Errorf("failed to decode data: %w", err)
+		}
+	}
+	if len(out.Errors) > 0 {
+		return &ResponseError{StatusCode: resp.StatusCode, Errors: out.Errors}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &ResponseError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+`
@@ -0,0 +1,147 @@
+package persistedquery
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/aereal/poc-graphql-pqs-server/domain"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+const (
+	defaultDBStoreCacheSize  = 1000
+	defaultDBStoreCacheTTL   = time.Second * 30
+	defaultNegativeCacheTTL  = time.Second * 5
+	defaultNegativeCacheSize = 10000
+)
+
+type dbStoreConfig struct {
+	cacheSize        int
+	cacheTTL         time.Duration
+	negativeCacheTTL time.Duration
+}
+
+type DBStoreOption func(*dbStoreConfig)
+
+func WithCacheSize(size int) DBStoreOption { return func(c *dbStoreConfig) { c.cacheSize = size } }
+
+// WithCacheTTL sets how long the operations are cached.
+// It bounds the time that the other instances sharing the database keep serving a retired operation.
+func WithCacheTTL(d time.Duration) DBStoreOption { return func(c *dbStoreConfig) { c.cacheTTL = d } }
+
+// WithNegativeCacheTTL sets how long the IDs that are not found are remembered. Zero disables the negative cache.
+func WithNegativeCacheTTL(d time.Duration) DBStoreOption {
+	return func(c *dbStoreConfig) { c.negativeCacheTTL = d }
+}
+
+func NewDBStore(repo *domain.PersistedOperationRepository, opts ...DBStoreOption) (*DBStore, error) {
+	cfg := &dbStoreConfig{cacheSize: defaultDBStoreCacheSize, cacheTTL: defaultDBStoreCacheTTL, negativeCacheTTL: defaultNegativeCacheTTL}
+	for _, o := range opts {
+		o(cfg)
+	}
+	cache, err := lru.New[string, cachedQuery](cfg.cacheSize)
+	if err != nil {
+		return nil, err
+	}
+	missing, err := lru.New[string, time.Time](defaultNegativeCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &DBStore{repo: repo, cache: cache, missing: missing, cacheTTL: cfg.cacheTTL, negativeCacheTTL: cfg.negativeCacheTTL}, nil
+}
+
+// DBStore is a graphql.Cache backed by the persisted_operations table.
+//
+// Operations are loaded on a cache miss and kept in an in-process LRU cache until the TTL expires.
+// The IDs that are not found are also remembered for a short while so that unknown IDs do not hit the database on every request.
+type DBStore struct {
+	repo             *domain.PersistedOperationRepository
+	cache            *lru.Cache[string, cachedQuery]
+	missing          *lru.Cache[string, time.Time] // ID to the expiry
+	cacheTTL         time.Duration
+	negativeCacheTTL time.Duration
+}
+
+type cachedQuery struct {
+	body      string
+	expiresAt time.Time
+}
+
+var _ graphql.Cache = (*DBStore)(nil)
+
+func (s *DBStore) Get(ctx context.Context, id string) (any, bool) {
+	body, err := s.LookupQuery(ctx, id)
+	if err != nil {
+		if !errors.Is(err, ErrQueryNotFound) {
+			slog.WarnContext(ctx, "failed to find persisted operation", slog.String("id", id), slog.String("error", err.Error()))
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+func (*DBStore) Add(context.Context, string, any) {}
+
+var _ QueryLookup = (*DBStore)(nil)
+
+// LookupQuery returns the body of the operation. It fails with ErrQueryNotFound if the operation is not registered or retired.
+func (s *DBStore) LookupQuery(ctx context.Context, id string) (string, error) {
+	if cached, ok := s.cache.Get(id); ok {
+		if time.Now().Before(cached.expiresAt) {
+			return cached.body, nil
+		}
+		s.cache.Remove(id)
+	}
+	if expiry, ok := s.missing.Get(id); ok {
+		if time.Now().Before(expiry) {
+			return "", ErrQueryNotFound
+		}
+		s.missing.Remove(id)
+	}
+	op, err := s.repo.FindPersistedOperationByID(ctx, id)
+	if err != nil {
+		var notFound *domain.NotFoundError[string, *domain.PersistedOperation]
+		if errors.As(err, &notFound) {
+			if s.negativeCacheTTL > 0 {
+				s.missing.Add(id, time.Now().Add(s.negativeCacheTTL))
+			}
+			return "", ErrQueryNotFound
+		}
+		return "", err
+	}
+	s.addCache(id, op.Body)
+	return op.Body, nil
+}
+
+func (s *DBStore) List(ctx context.Context) ([]*domain.PersistedOperation, error) {
+	return s.repo.ListPersistedOperations(ctx)
+}
+
+// Register stores the operation and makes it available immediately.
+func (s *DBStore) Register(ctx context.Context, op *domain.PersistedOperation) (*domain.PersistedOperation, error) {
+	registered, err := s.repo.RegisterPersistedOperation(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	s.missing.Remove(registered.ID)
+	s.addCache(registered.ID, registered.Body)
+	return registered, nil
+}
+
+// Retire marks the operation as retired and evicts it from the cache so that it is no longer runnable.
+// The other instances stop serving it once their cache expires.
+func (s *DBStore) Retire(ctx context.Context, id string) (*domain.PersistedOperation, error) {
+	retired, err := s.repo.RetirePersistedOperation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Remove(id)
+	return retired, nil
+}
+
+func (s *DBStore) addCache(id, body string) {
+	s.cache.Add(id, cachedQuery{body: body, expiresAt: time.Now().Add(s.cacheTTL)})
+}
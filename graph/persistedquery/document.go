@@ -0,0 +1,122 @@
+package persistedquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const defaultDocumentIDPrefix = "sha256:"
+
+type (
+	documentIDCtxKey    struct{}
+	requestMethodCtxKey struct{}
+)
+
+func withDocumentID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, documentIDCtxKey{}, id)
+}
+
+// DocumentIDFromContext returns the documentId sent by the client in the GraphQL over HTTP persisted documents protocol.
+func DocumentIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(documentIDCtxKey{}).(string)
+	return id, ok && id != ""
+}
+
+// isGETRequest reports whether the operation is requested with GET, on which the transport refuses the operations other than queries.
+func isGETRequest(ctx context.Context) bool {
+	method, _ := ctx.Value(requestMethodCtxKey{}).(string)
+	return method == http.MethodGet
+}
+
+// DocumentIDTransport wraps a transport to accept the documentId request parameter.
+//
+// graphql.RawParams has no room for documentId, so the transport passes it to PersistedDocument through the request context.
+// The request method is passed as well so that the extensions can skip the operations that the GET transport refuses after them.
+type DocumentIDTransport struct {
+	graphql.Transport
+}
+
+var _ graphql.Transport = DocumentIDTransport{}
+
+func (t DocumentIDTransport) Do(w http.ResponseWriter, r *http.Request, exec graphql.GraphExecutor) {
+	ctx := context.WithValue(r.Context(), requestMethodCtxKey{}, r.Method)
+	if id := documentIDOf(r); id != "" {
+		ctx = withDocumentID(ctx, id)
+	}
+	r = r.WithContext(ctx)
+	t.Transport.Do(w, r, exec)
+}
+
+func documentIDOf(r *http.Request) string {
+	if r.Method == http.MethodGet {
+		return r.URL.Query().Get("documentId")
+	}
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var params struct {
+		DocumentID string `json:"documentId"`
+	}
+	if err := json.Unmarshal(body, &params); err != nil {
+		return ""
+	}
+	return params.DocumentID
+}
+
+// PersistedDocument is a handler extension that resolves documentId through the Cache.
+//
+// It does nothing for requests without documentId, so it can be used together with AutomaticPersistedQuery or Safelist.
+type PersistedDocument struct {
+	Cache graphql.Cache
+	// Prefixes are stripped from documentId when the documentId itself is not found in the Cache.
+	// Defaults to "sha256:".
+	Prefixes []string
+}
+
+var _ interface {
+	graphql.OperationParameterMutator
+	graphql.HandlerExtension
+} = PersistedDocument{}
+
+func (PersistedDocument) ExtensionName() string { return "PersistedDocument" }
+
+func (d PersistedDocument) Validate(graphql.ExecutableSchema) error {
+	if d.Cache == nil {
+		return ErrNilCache
+	}
+	return nil
+}
+
+func (d PersistedDocument) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	documentID, ok := DocumentIDFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if _, err := lookupQuery(ctx, d.Cache, documentID); !errors.Is(err, ErrQueryNotFound) {
+		return resolve(ctx, d.Cache, documentID, rawParams)
+	}
+	prefixes := d.Prefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{defaultDocumentIDPrefix}
+	}
+	for _, prefix := range prefixes {
+		if id, found := strings.CutPrefix(documentID, prefix); found {
+			return resolve(ctx, d.Cache, id, rawParams)
+		}
+	}
+	return newNotFoundError()
+}
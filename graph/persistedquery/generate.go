@@ -0,0 +1,148 @@
+package persistedquery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/formatter"
+	"github.com/vektah/gqlparser/v2/lexer"
+	"github.com/vektah/gqlparser/v2/parser"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+type generateConfig struct {
+	pretty bool
+}
+
+type GenerateOption func(*generateConfig)
+
+// WithPrettyBody keeps the normalized bodies indented instead of minifying them.
+func WithPrettyBody(on bool) GenerateOption { return func(c *generateConfig) { c.pretty = on } }
+
+// GenerateManifest builds a manifest from the operation documents.
+//
+// Fragments are shared across the sources, and each operation body contains only the fragments it uses.
+func GenerateManifest(schema *ast.Schema, sources []*ast.Source, opts ...GenerateOption) (*apollo.Manifest, error) {
+	var cfg generateConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	merged := &ast.QueryDocument{}
+	for _, src := range sources {
+		doc, err := parser.ParseQuery(src)
+		if err != nil {
+			return nil, err
+		}
+		merged.Operations = append(merged.Operations, doc.Operations...)
+		merged.Fragments = append(merged.Fragments, doc.Fragments...)
+	}
+	if errs := validator.Validate(schema, merged); len(errs) > 0 {
+		return nil, errs
+	}
+
+	manifest := &apollo.Manifest{Format: apollo.SupportedFormat, Version: apollo.SupportedVersion, Operations: make([]apollo.Operation, 0, len(merged.Operations))}
+	for _, op := range merged.Operations {
+		if op.Name == "" {
+			return nil, fmt.Errorf("anonymous operation at %s:%d cannot be persisted", op.Position.Src.Name, op.Position.Line)
+		}
+		doc := &ast.QueryDocument{Operations: ast.OperationList{op}, Fragments: usedFragments(merged.Fragments, op.SelectionSet)}
+		body, err := formatDocument(doc, cfg.pretty)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op.Name, err)
+		}
+		manifest.Operations = append(manifest.Operations, apollo.Operation{
+			ID:   apollo.ComputeID(body),
+			Name: op.Name,
+			Type: string(op.Operation),
+			Body: body,
+		})
+	}
+	sort.Slice(manifest.Operations, func(i, j int) bool { return manifest.Operations[i].Name < manifest.Operations[j].Name })
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func usedFragments(fragments ast.FragmentDefinitionList, selectionSet ast.SelectionSet) ast.FragmentDefinitionList {
+	seen := make(map[string]bool)
+	var walk func(ast.SelectionSet)
+	walk = func(set ast.SelectionSet) {
+		for _, sel := range set {
+			switch sel := sel.(type) {
+			case *ast.Field:
+				walk(sel.SelectionSet)
+			case *ast.InlineFragment:
+				walk(sel.SelectionSet)
+			case *ast.FragmentSpread:
+				if seen[sel.Name] {
+					continue
+				}
+				seen[sel.Name] = true
+				if def := fragments.ForName(sel.Name); def != nil {
+					walk(def.SelectionSet)
+				}
+			}
+		}
+	}
+	walk(selectionSet)
+	used := make(ast.FragmentDefinitionList, 0, len(seen))
+	for _, def := range fragments {
+		if seen[def.Name] {
+			used = append(used, def)
+		}
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].Name < used[j].Name })
+	return used
+}
+
+func formatDocument(doc *ast.QueryDocument, pretty bool) (string, error) {
+	var buf bytes.Buffer
+	formatter.NewFormatter(&buf, formatter.WithIndent("  ")).FormatQueryDocument(doc)
+	if pretty {
+		return strings.TrimSpace(buf.String()), nil
+	}
+	return Minify(buf.String())
+}
+
+// Minify removes the insignificant whitespaces and comments from the document.
+func Minify(document string) (string, error) {
+	src := &ast.Source{Input: document}
+	runes := []rune(document)
+	lex := lexer.New(src)
+	var b strings.Builder
+	prevIsWord := false
+	for {
+		tok, err := lex.ReadToken()
+		if err != nil {
+			return "", err
+		}
+		if tok.Kind == lexer.EOF {
+			break
+		}
+		isWord := isWordToken(tok.Kind)
+		if prevIsWord && isWord {
+			b.WriteByte(' ')
+		}
+		b.WriteString(string(runes[tok.Pos.Start:tok.Pos.End]))
+		prevIsWord = isWord
+	}
+	if b.Len() == 0 {
+		return "", errors.New("empty document")
+	}
+	return b.String(), nil
+}
+
+func isWordToken(kind lexer.Type) bool {
+	switch kind {
+	case lexer.Name, lexer.Int, lexer.Float, lexer.String, lexer.BlockString:
+		return true
+	default:
+		return false
+	}
+}
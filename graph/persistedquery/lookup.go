@@ -0,0 +1,59 @@
+package persistedquery
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+)
+
+// ErrQueryNotFound is returned by QueryLookup when the query is not registered.
+var ErrQueryNotFound = errors.New("persisted query is not found")
+
+// QueryLookup is implemented by caches that can fail to look up a query for reasons other than the query being unknown,
+// such as the ones backed by a database.
+type QueryLookup interface {
+	LookupQuery(ctx context.Context, id string) (string, error)
+}
+
+func lookupQuery(ctx context.Context, cache graphql.Cache, id string) (string, error) {
+	if l, ok := cache.(QueryLookup); ok {
+		return l.LookupQuery(ctx, id)
+	}
+	v, ok := cache.Get(ctx, id)
+	if !ok {
+		return "", ErrQueryNotFound
+	}
+	body, ok := v.(string)
+	if !ok {
+		return "", ErrQueryNotFound
+	}
+	return body, nil
+}
+
+// OperationLookup is implemented by caches that know the metadata of the operations, such as the ones built by apollo.New.
+type OperationLookup interface {
+	LookupOperation(ctx context.Context, id string) (*apollo.Operation, bool)
+}
+
+func lookupOperation(ctx context.Context, cache graphql.Cache, id string) (*apollo.Operation, bool) {
+	l, ok := cache.(OperationLookup)
+	if !ok {
+		return nil, false
+	}
+	return l.LookupOperation(ctx, id)
+}
+
+// currentOperation returns the persisted operation that the current request runs, or nil if it is unknown.
+func currentOperation(ctx context.Context, cache graphql.Cache) *apollo.Operation {
+	if stats := GetStats(ctx); stats != nil {
+		return stats.Operation
+	}
+	if stats := extension.GetApqStats(ctx); stats != nil && !stats.SentQuery {
+		op, _ := lookupOperation(ctx, cache, stats.Hash)
+		return op
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package persistedquery
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/relay"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/yamllist"
+)
+
+// EnvManifestFormat is the environment variable that names the manifest format for WithManifestFormat.
+const EnvManifestFormat = "PERSISTED_QUERY_MANIFEST_FORMAT"
+
+var ErrUnknownManifestFormat = errors.New("unknown manifest format")
+
+// ManifestFormat describes a manifest format that can be converted into an apollo.Manifest.
+type ManifestFormat struct {
+	Name   string
+	Detect func(data []byte) bool
+	Decode func(data []byte) (*apollo.Manifest, error)
+}
+
+// manifestFormats are tried in order on auto-detection, so the more specific format comes first.
+var manifestFormats = []ManifestFormat{
+	{Name: apollo.SupportedFormat, Detect: apollo.Detect, Decode: apollo.DecodeBytes},
+	{Name: relay.Format, Detect: relay.Detect, Decode: relay.Decode},
+	{Name: yamllist.Format, Detect: yamllist.Detect, Decode: yamllist.Decode},
+}
+
+// RegisterManifestFormat adds a manifest format. It is tried after the built-in ones on auto-detection.
+func RegisterManifestFormat(f ManifestFormat) {
+	manifestFormats = append(manifestFormats, f)
+}
+
+type decodeConfig struct {
+	format      string
+	trustedKeys []ed25519.PublicKey
+}
+
+type DecodeOption func(*decodeConfig)
+
+// WithManifestFormat disables auto-detection and decodes the manifest as the named format.
+func WithManifestFormat(name string) DecodeOption {
+	return func(c *decodeConfig) { c.format = name }
+}
+
+// WithTrustedKeys requires each manifest file to have a detached signature file made by one of the keys.
+// It takes effect only on reading files.
+func WithTrustedKeys(keys ...ed25519.PublicKey) DecodeOption {
+	return func(c *decodeConfig) { c.trustedKeys = keys }
+}
+
+// DecodeOptionsFromEnv returns the options configured by EnvManifestFormat and EnvManifestPublicKeys.
+func DecodeOptionsFromEnv() ([]DecodeOption, error) {
+	opts := make([]DecodeOption, 0)
+	if format := os.Getenv(EnvManifestFormat); format != "" {
+		opts = append(opts, WithManifestFormat(format))
+	}
+	keys, err := TrustedKeysFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		opts = append(opts, WithTrustedKeys(keys...))
+	}
+	return opts, nil
+}
+
+func DecodeManifest(data []byte, opts ...DecodeOption) (*apollo.Manifest, error) {
+	var cfg decodeConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	for _, f := range manifestFormats {
+		if cfg.format != "" && f.Name != cfg.format {
+			continue
+		}
+		if cfg.format == "" && !f.Detect(data) {
+			continue
+		}
+		manifest, err := f.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		return manifest, nil
+	}
+	if cfg.format != "" {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownManifestFormat, cfg.format)
+	}
+	return nil, ErrUnknownManifestFormat
+}
+
+func ReadManifestFile(file string, opts ...DecodeOption) (*apollo.Manifest, error) {
+	var cfg decodeConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(cfg.trustedKeys) > 0 {
+		signature, err := os.ReadFile(file + SignatureFileSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signature file: %w", err)
+		}
+		if err := VerifyManifestSignature(cfg.trustedKeys, data, signature); err != nil {
+			return nil, err
+		}
+	}
+	return DecodeManifest(data, opts...)
+}
+
+// MergedManifest is a manifest merged from several files.
+type MergedManifest struct {
+	*apollo.Manifest
+	// Sources maps an operation or alias ID to the file it came from.
+	Sources map[string]string
+}
+
+type ConflictError struct {
+	ID    string
+	Files [2]string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("operation %q is defined differently in %s and %s", e.ID, e.Files[0], e.Files[1])
+}
+
+// NameConflictError tells that different operations have the same name in different files.
+type NameConflictError struct {
+	Name  string
+	Files [2]string
+}
+
+func (e *NameConflictError) Error() string {
+	return fmt.Sprintf("operation name %q is used by different operations in %s and %s", e.Name, e.Files[0], e.Files[1])
+}
+
+// ReadManifestFiles reads and merges the manifests matched by the path.
+// The path may be a file, a directory, or a glob pattern.
+//
+// An operation ID that maps to different bodies or metadata such as policies in different files is reported as ConflictError,
+// as is an alias ID that maps to different targets or variable transforms, or is also used by an operation.
+// An operation name used by different operations in different files is reported as NameConflictError.
+func ReadManifestFiles(path string, opts ...DecodeOption) (*MergedManifest, error) {
+	files, err := manifestFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	merged := &MergedManifest{
+		Manifest: &apollo.Manifest{Format: apollo.SupportedFormat, Version: apollo.SupportedVersion},
+		Sources:  make(map[string]string),
+	}
+	operations := make(map[string]apollo.Operation)
+	names := make(map[string]string) // operation name to ID
+	aliases := make(map[string]apollo.Alias)
+	aliasSources := make(map[string]string)
+	var conflicts error
+	for _, file := range files {
+		manifest, err := ReadManifestFile(file, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, op := range manifest.Operations {
+			if defined, ok := operations[op.ID]; ok {
+				if !sameDefinition(defined, op) {
+					conflicts = errors.Join(conflicts, &ConflictError{ID: op.ID, Files: [2]string{merged.Sources[op.ID], file}})
+				}
+				continue
+			}
+			if id, ok := names[op.Name]; ok && op.Name != "" {
+				conflicts = errors.Join(conflicts, &NameConflictError{Name: op.Name, Files: [2]string{merged.Sources[id], file}})
+				continue
+			}
+			if op.Name != "" {
+				names[op.Name] = op.ID
+			}
+			operations[op.ID] = op
+			merged.Sources[op.ID] = file
+			merged.Operations = append(merged.Operations, op)
+		}
+		for _, alias := range manifest.Aliases {
+			if defined, ok := aliases[alias.ID]; ok {
+				if !sameDefinition(defined, alias) {
+					conflicts = errors.Join(conflicts, &ConflictError{ID: alias.ID, Files: [2]string{aliasSources[alias.ID], file}})
+				}
+				continue
+			}
+			aliases[alias.ID] = alias
+			aliasSources[alias.ID] = file
+			merged.Aliases = append(merged.Aliases, alias)
+		}
+	}
+	for _, alias := range merged.Aliases {
+		if _, ok := operations[alias.ID]; ok {
+			conflicts = errors.Join(conflicts, &ConflictError{ID: alias.ID, Files: [2]string{merged.Sources[alias.ID], aliasSources[alias.ID]}})
+			continue
+		}
+		merged.Sources[alias.ID] = aliasSources[alias.ID]
+	}
+	if conflicts != nil {
+		return nil, conflicts
+	}
+	return merged, nil
+}
+
+// sameDefinition compares the operations or aliases by their JSON representations, which include the metadata.
+func sameDefinition(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+var manifestExtensions = map[string]bool{".json": true, ".yml": true, ".yaml": true}
+
+func manifestFiles(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	switch {
+	case err == nil && !fi.IsDir():
+		return []string{path}, nil
+	case err == nil:
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory: %w", err)
+		}
+		files := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if entry.IsDir() || !manifestExtensions[filepath.Ext(entry.Name())] {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no manifest files in %s", path)
+		}
+		return files, nil
+	default:
+		files, globErr := filepath.Glob(path)
+		if globErr != nil {
+			return nil, fmt.Errorf("invalid glob pattern: %w", globErr)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("failed to read manifest: %w", err)
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+}
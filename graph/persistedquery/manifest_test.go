@@ -0,0 +1,140 @@
+package persistedquery_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+)
+
+func writeManifestFile(t *testing.T, dir, name string, manifest *apollo.Manifest) string {
+	t.Helper()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestReadManifestFile_idVerification(t *testing.T) {
+	body := "query Typename { __typename }"
+	cases := []struct {
+		name    string
+		id      string
+		wantErr error
+	}{
+		{name: "ID is the hash of the body", id: apollo.ComputeID(body)},
+		{name: "ID is the hash of another body", id: apollo.ComputeID("query Other { __typename }"), wantErr: apollo.ErrIDMismatch},
+		{name: "ID is not a hash", id: "typename", wantErr: apollo.ErrIDMismatch},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			file := writeManifestFile(t, t.TempDir(), "manifest.json", newTestManifest(apollo.Operation{ID: c.id, Name: "Typename", Body: body}))
+			manifest, err := persistedquery.ReadManifestFile(file)
+			if c.wantErr == nil {
+				if err != nil {
+					t.Fatalf("want no error, got %v", err)
+				}
+				if len(manifest.Operations) != 1 {
+					t.Errorf("want 1 operation, got %d", len(manifest.Operations))
+				}
+				return
+			}
+			if !errors.Is(err, c.wantErr) {
+				t.Errorf("want %v, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadManifestFiles_merge(t *testing.T) {
+	body := "query Typename { __typename }"
+	other := "query Schema { __schema { queryType { name } } }"
+	typename := apollo.Operation{Name: "Typename", Body: body}
+	deprecated := apollo.Operation{Name: "Typename", Body: body, Policy: &apollo.Policy{Deprecated: true}}
+	renamed := apollo.Operation{Name: "Renamed", Body: body}
+	sameName := apollo.Operation{Name: "Typename", Body: other}
+	cases := []struct {
+		name             string
+		files            [2]*apollo.Manifest
+		wantOperations   int
+		wantConflict     bool
+		wantNameConflict bool
+	}{
+		{name: "same operation", files: [2]*apollo.Manifest{newTestManifest(typename), newTestManifest(typename)}, wantOperations: 1},
+		{name: "different operations", files: [2]*apollo.Manifest{newTestManifest(typename), newTestManifest(apollo.Operation{Name: "Schema", Body: other})}, wantOperations: 2},
+		{name: "same body with another policy", files: [2]*apollo.Manifest{newTestManifest(typename), newTestManifest(deprecated)}, wantConflict: true},
+		{name: "same body with another name", files: [2]*apollo.Manifest{newTestManifest(typename), newTestManifest(renamed)}, wantConflict: true},
+		{name: "same name with another body", files: [2]*apollo.Manifest{newTestManifest(typename), newTestManifest(sameName)}, wantNameConflict: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			first := writeManifestFile(t, dir, "1.json", c.files[0])
+			second := writeManifestFile(t, dir, "2.json", c.files[1])
+			merged, err := persistedquery.ReadManifestFiles(dir)
+			wantFiles := [2]string{first, second}
+			var conflict *persistedquery.ConflictError
+			var nameConflict *persistedquery.NameConflictError
+			switch {
+			case c.wantConflict:
+				if !errors.As(err, &conflict) {
+					t.Fatalf("want ConflictError, got %v", err)
+				}
+				if conflict.Files != wantFiles {
+					t.Errorf("files: want %v, got %v", wantFiles, conflict.Files)
+				}
+			case c.wantNameConflict:
+				if !errors.As(err, &nameConflict) {
+					t.Fatalf("want NameConflictError, got %v", err)
+				}
+				if nameConflict.Files != wantFiles {
+					t.Errorf("files: want %v, got %v", wantFiles, nameConflict.Files)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("want no error, got %v", err)
+				}
+				if len(merged.Operations) != c.wantOperations {
+					t.Errorf("operations: want %d, got %d", c.wantOperations, len(merged.Operations))
+				}
+			}
+		})
+	}
+}
+
+func TestReadManifestFiles_mergeAliases(t *testing.T) {
+	body := "query Typename { __typename }"
+	typename := apollo.Operation{Name: "Typename", Body: body}
+	aliasID := apollo.ComputeID("query Typename { __schema { queryType { name } } }")
+	withAlias := func(alias apollo.Alias) *apollo.Manifest {
+		manifest := newTestManifest(typename)
+		manifest.Aliases = []apollo.Alias{alias}
+		return manifest
+	}
+	plain := apollo.Alias{ID: aliasID, Target: apollo.ComputeID(body)}
+	transformed := apollo.Alias{ID: aliasID, Target: apollo.ComputeID(body), Variables: &apollo.VariableTransform{Drop: []string{"unused"}}}
+
+	dir := t.TempDir()
+	writeManifestFile(t, dir, "1.json", withAlias(plain))
+	writeManifestFile(t, dir, "2.json", withAlias(plain))
+	if merged, err := persistedquery.ReadManifestFiles(dir); err != nil || len(merged.Aliases) != 1 {
+		t.Fatalf("same alias: want 1 alias without error, got %v", err)
+	}
+
+	dir = t.TempDir()
+	writeManifestFile(t, dir, "1.json", withAlias(plain))
+	writeManifestFile(t, dir, "2.json", withAlias(transformed))
+	var conflict *persistedquery.ConflictError
+	if _, err := persistedquery.ReadManifestFiles(dir); !errors.As(err, &conflict) || conflict.ID != aliasID {
+		t.Errorf("alias with another variable transform: want ConflictError of the alias, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package persistedquery
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	errOperationNameMismatchCode = "PERSISTED_QUERY_OPERATION_NAME_MISMATCH"
+	errOperationTypeMismatchCode = "PERSISTED_QUERY_OPERATION_TYPE_MISMATCH"
+)
+
+// OperationMetadataCheck is a handler extension that checks the request against the name and the type of the persisted operation.
+//
+// The operation name is filled in if the request omits it. Requests for an alias always run the target operation under its own name.
+// It must be used after the extension that resolves the persisted query such as Safelist.
+type OperationMetadataCheck struct {
+	Cache graphql.Cache
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+	graphql.OperationContextMutator
+} = OperationMetadataCheck{}
+
+func (OperationMetadataCheck) ExtensionName() string { return "PersistedQueryOperationMetadataCheck" }
+
+func (c OperationMetadataCheck) Validate(graphql.ExecutableSchema) error {
+	if c.Cache == nil {
+		return ErrNilCache
+	}
+	return nil
+}
+
+func (c OperationMetadataCheck) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	op := currentOperation(ctx, c.Cache)
+	if op == nil || op.Name == "" {
+		return nil
+	}
+	if _, ok := lookupAlias(ctx, c.Cache, persistedQueryID(ctx)); ok || rawParams.OperationName == "" {
+		rawParams.OperationName = op.Name
+		return nil
+	}
+	if rawParams.OperationName != op.Name {
+		err := gqlerror.Errorf("operation name %q does not match the persisted operation %q", rawParams.OperationName, op.Name)
+		errcode.Set(err, errOperationNameMismatchCode)
+		return err
+	}
+	return nil
+}
+
+func (c OperationMetadataCheck) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	op := currentOperation(ctx, c.Cache)
+	if op == nil || op.Type == "" || rc.Operation == nil {
+		return nil
+	}
+	if rc.Operation.Operation != ast.Operation(op.Type) {
+		err := gqlerror.Errorf("operation type %s does not match the persisted operation type %s", rc.Operation.Operation, op.Type)
+		errcode.Set(err, errOperationTypeMismatchCode)
+		return err
+	}
+	return nil
+}
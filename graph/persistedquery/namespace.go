@@ -0,0 +1,132 @@
+package persistedquery
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	errUnknownClient     = "UnknownClient"
+	errUnknownClientCode = "PERSISTED_QUERY_UNKNOWN_CLIENT"
+)
+
+// ClientValidator is implemented by caches that serve only particular clients.
+type ClientValidator interface {
+	ValidateClient(ctx context.Context) *gqlerror.Error
+}
+
+// NewNamespaces returns a graphql.Cache that picks a query list by the client.
+//
+// The key of lists is either a client name or a client name and version joined with "@" such as "ios@2.1.0".
+// The key with version takes precedence.
+func NewNamespaces(lists map[string]graphql.Cache) *Namespaces {
+	return &Namespaces{lists: lists}
+}
+
+type Namespaces struct {
+	lists map[string]graphql.Cache
+}
+
+var (
+	_ graphql.Cache   = (*Namespaces)(nil)
+	_ ClientValidator = (*Namespaces)(nil)
+)
+
+func (n *Namespaces) listFor(ctx context.Context) graphql.Cache {
+	info, ok := ClientInfoFromContext(ctx)
+	if !ok || info.Name == "" {
+		return nil
+	}
+	if info.Version != "" {
+		if list, ok := n.lists[info.Name+"@"+info.Version]; ok {
+			return list
+		}
+	}
+	return n.lists[info.Name]
+}
+
+func (n *Namespaces) Get(ctx context.Context, key string) (any, bool) {
+	list := n.listFor(ctx)
+	if list == nil {
+		return nil, false
+	}
+	return list.Get(ctx, key)
+}
+
+func (*Namespaces) Add(context.Context, string, any) {}
+
+var _ OperationLookup = (*Namespaces)(nil)
+
+func (n *Namespaces) LookupOperation(ctx context.Context, id string) (*apollo.Operation, bool) {
+	list := n.listFor(ctx)
+	if list == nil {
+		return nil, false
+	}
+	return lookupOperation(ctx, list, id)
+}
+
+var _ AliasLookup = (*Namespaces)(nil)
+
+func (n *Namespaces) LookupAlias(ctx context.Context, id string) (*apollo.Alias, bool) {
+	list := n.listFor(ctx)
+	if list == nil {
+		return nil, false
+	}
+	return lookupAlias(ctx, list, id)
+}
+
+var _ DocumentLookup = (*Namespaces)(nil)
+
+func (n *Namespaces) LookupDocument(ctx context.Context, query string) (*ast.QueryDocument, bool) {
+	list := n.listFor(ctx)
+	if list == nil {
+		return nil, false
+	}
+	return lookupDocument(ctx, list, query)
+}
+
+func (n *Namespaces) ValidateClient(ctx context.Context) *gqlerror.Error {
+	if n.listFor(ctx) != nil {
+		return nil
+	}
+	err := gqlerror.Errorf(errUnknownClient)
+	errcode.Set(err, errUnknownClientCode)
+	return err
+}
+
+func validateClient(ctx context.Context, cache graphql.Cache) *gqlerror.Error {
+	if v, ok := cache.(ClientValidator); ok {
+		return v.ValidateClient(ctx)
+	}
+	return nil
+}
+
+// ClientCheck is a handler extension that rejects the clients that the Cache does not serve.
+//
+// It must be used before the extension that resolves the persisted query, such as AutomaticPersistedQuery, which does not know ClientValidator.
+type ClientCheck struct {
+	Cache graphql.Cache
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+} = ClientCheck{}
+
+func (ClientCheck) ExtensionName() string { return "PersistedQueryClientCheck" }
+
+func (c ClientCheck) Validate(graphql.ExecutableSchema) error {
+	if c.Cache == nil {
+		return ErrNilCache
+	}
+	return nil
+}
+
+func (c ClientCheck) MutateOperationParameters(ctx context.Context, _ *graphql.RawParams) *gqlerror.Error {
+	return validateClient(ctx, c.Cache)
+}
@@ -0,0 +1,88 @@
+package persistedquery_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+)
+
+// newAPQHandler builds the public endpoint without the strict safelist as web does.
+func newAPQHandler(es graphql.ExecutableSchema, cache graphql.Cache) http.Handler {
+	h := handler.New(es)
+	h.AddTransport(persistedquery.DocumentIDTransport{Transport: transport.GET{}})
+	h.AddTransport(persistedquery.DocumentIDTransport{Transport: transport.POST{}})
+	h.SetQueryCache(persistedquery.DocumentCache{Cache: cache})
+	h.Use(persistedquery.ClientCheck{Cache: cache})
+	h.Use(persistedquery.PersistedDocument{Cache: cache})
+	h.Use(persistedquery.AliasedQuery{Cache: cache})
+	h.Use(extension.AutomaticPersistedQuery{Cache: cache})
+	return persistedquery.ClientInfoMiddleware(h)
+}
+
+func TestNamespaces(t *testing.T) {
+	es := newTestSchema()
+	bodyA := "query OnlyA { __typename }"
+	bodyB := "query OnlyB { __schema { queryType { name } } }"
+	namespaces := persistedquery.NewNamespaces(map[string]graphql.Cache{
+		"a": newTestList(t, es, apollo.Operation{Name: "OnlyA", Body: bodyA}),
+		"b": newTestList(t, es, apollo.Operation{Name: "OnlyB", Body: bodyB}),
+	})
+	handlers := map[string]http.Handler{
+		"strict": newStrictHandler(es, namespaces),
+		"apq":    newAPQHandler(es, namespaces),
+	}
+	client := func(name string) http.Header {
+		h := make(http.Header)
+		if name != "" {
+			h.Set(persistedquery.HeaderClientName, name)
+		}
+		return h
+	}
+	cases := []struct {
+		name     string
+		client   string
+		hash     string
+		wantCode string
+	}{
+		{name: "own operation", client: "a", hash: apollo.ComputeID(bodyA)},
+		{name: "operation of another client", client: "a", hash: apollo.ComputeID(bodyB), wantCode: "PERSISTED_QUERY_NOT_FOUND"},
+		{name: "unknown client", client: "evil", hash: apollo.ComputeID(bodyA), wantCode: "PERSISTED_QUERY_UNKNOWN_CLIENT"},
+		{name: "no client", hash: apollo.ComputeID(bodyA), wantCode: "PERSISTED_QUERY_UNKNOWN_CLIENT"},
+	}
+	for mode, h := range handlers {
+		// warm the document cache with the operation of b
+		if resp := getGraphQL(t, h, persistedQueryParams(apollo.ComputeID(bodyB)), client("b")); resp.errorCode() != "" {
+			t.Fatalf("%s: client b cannot run its own operation: %+v", mode, resp.Errors)
+		}
+		for _, c := range cases {
+			for method, do := range map[string]func(*testing.T, http.Handler, map[string]any, http.Header) testResponse{"GET": getGraphQL, "POST": postGraphQL} {
+				t.Run(mode+"/"+method+"/"+c.name, func(t *testing.T) {
+					resp := do(t, h, persistedQueryParams(c.hash), client(c.client))
+					if got := resp.errorCode(); got != c.wantCode {
+						t.Fatalf("error code: want %q, got %q (%+v)", c.wantCode, got, resp.Errors)
+					}
+					if c.wantCode != "" && resp.Data != nil {
+						t.Errorf("data: want nil, got %v", resp.Data)
+					}
+				})
+			}
+		}
+	}
+
+	t.Run("strict/body of another client", func(t *testing.T) {
+		params := persistedQueryParams(apollo.ComputeID(bodyB))
+		params["query"] = bodyB
+		for method, do := range map[string]func(*testing.T, http.Handler, map[string]any, http.Header) testResponse{"GET": getGraphQL, "POST": postGraphQL} {
+			resp := do(t, handlers["strict"], params, client("a"))
+			if got := resp.errorCode(); got != "PERSISTED_QUERY_NOT_FOUND" {
+				t.Errorf("%s: error code: want PERSISTED_QUERY_NOT_FOUND, got %q (%+v)", method, got, resp.Errors)
+			}
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package persistedquery
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aereal/poc-graphql-pqs-server/domain"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultPendingSeenSize    = 1000
+	defaultPendingMaxBodySize = 64 * 1024
+	defaultPendingRate        = rate.Limit(1)
+	defaultPendingBurst       = 10
+)
+
+// UnknownOperationCapturer is notified of the queries that the safelist rejected because they are not registered.
+type UnknownOperationCapturer interface {
+	CaptureUnknownOperation(ctx context.Context, hash, query string)
+}
+
+type pendingCapturerConfig struct {
+	maxBodySize int
+	limiter     *rate.Limiter
+}
+
+type PendingCapturerOption func(*pendingCapturerConfig)
+
+// WithMaxPendingBodySize ignores the queries larger than the size in bytes.
+func WithMaxPendingBodySize(size int) PendingCapturerOption {
+	return func(c *pendingCapturerConfig) { c.maxBodySize = size }
+}
+
+// WithPendingRateLimit limits the rate of storing queries so that junk does not fill up the review queue.
+func WithPendingRateLimit(r rate.Limit, burst int) PendingCapturerOption {
+	return func(c *pendingCapturerConfig) { c.limiter = rate.NewLimiter(r, burst) }
+}
+
+func NewPendingCapturer(schema *ast.Schema, repo *domain.PendingOperationRepository, opts ...PendingCapturerOption) (*PendingCapturer, error) {
+	cfg := &pendingCapturerConfig{maxBodySize: defaultPendingMaxBodySize, limiter: rate.NewLimiter(defaultPendingRate, defaultPendingBurst)}
+	for _, o := range opts {
+		o(cfg)
+	}
+	seen, err := lru.New[string, struct{}](defaultPendingSeenSize)
+	if err != nil {
+		return nil, err
+	}
+	return &PendingCapturer{schema: schema, repo: repo, seen: seen, maxBodySize: cfg.maxBodySize, limiter: cfg.limiter}, nil
+}
+
+// PendingCapturer stores the rejected queries into the pending_operations table for a review.
+//
+// Queries whose hash does not match or that are invalid against the schema are ignored,
+// and each query is stored at most once while it stays in the in-process LRU cache.
+type PendingCapturer struct {
+	schema      *ast.Schema
+	repo        *domain.PendingOperationRepository
+	seen        *lru.Cache[string, struct{}]
+	maxBodySize int
+	limiter     *rate.Limiter
+}
+
+var _ UnknownOperationCapturer = (*PendingCapturer)(nil)
+
+func (c *PendingCapturer) CaptureUnknownOperation(ctx context.Context, hash, query string) {
+	if len(query) > c.maxBodySize || hash != apollo.ComputeID(query) {
+		return
+	}
+	if ok, _ := c.seen.ContainsOrAdd(hash, struct{}{}); ok {
+		return
+	}
+	if _, errs := ValidateDocument(c.schema, query); len(errs) > 0 {
+		return
+	}
+	if !c.limiter.Allow() {
+		c.seen.Remove(hash)
+		slog.WarnContext(ctx, "too many pending operations; skip capturing", slog.String("id", hash))
+		return
+	}
+	op := &domain.PendingOperation{ID: hash, Body: query}
+	if info, ok := ClientInfoFromContext(ctx); ok {
+		op.ClientName = info.Name
+		op.ClientVersion = info.Version
+	}
+	if err := c.repo.CapturePendingOperation(ctx, op); err != nil {
+		c.seen.Remove(hash)
+		slog.WarnContext(ctx, "failed to capture pending operation", slog.String("id", hash), slog.String("error", err.Error()))
+		return
+	}
+	slog.InfoContext(ctx, "captured pending operation", slog.String("id", hash), slog.String("client_name", op.ClientName))
+}
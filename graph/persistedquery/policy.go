@@ -0,0 +1,205 @@
+package persistedquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+const (
+	errRateLimitedCode     = "RATE_LIMITED"
+	errOperationSunsetCode = "OPERATION_SUNSET"
+	warnDeprecatedCode     = "DEPRECATED_OPERATION"
+)
+
+type policyConfig struct {
+	limiters map[string]*rate.Limiter
+}
+
+type PolicyOption func(*policyConfig)
+
+// WithRateLimit limits the operations of the rate limit class to r per second with bursts of at most burst operations.
+func WithRateLimit(class string, r rate.Limit, burst int) PolicyOption {
+	return func(c *policyConfig) { c.limiters[class] = rate.NewLimiter(r, burst) }
+}
+
+// UnknownRateLimitClassError tells that an operation declares a rate limit class that is not configured.
+type UnknownRateLimitClassError struct {
+	ID    string
+	Name  string
+	Class string
+}
+
+func (e *UnknownRateLimitClassError) Error() string {
+	return fmt.Sprintf("operation (id=%q name=%q) has the rate limit class %q that is not configured", e.ID, e.Name, e.Class)
+}
+
+// ValidateRateLimitClasses reports every operation whose rate limit class is not one of the classes,
+// since PolicyEnforcer would run it without any limit.
+func ValidateRateLimitClasses(manifest *apollo.Manifest, classes []string) error {
+	var err error
+	for _, op := range manifest.Operations {
+		if op.Policy == nil || op.Policy.RateLimitClass == "" || slices.Contains(classes, op.Policy.RateLimitClass) {
+			continue
+		}
+		err = errors.Join(err, &UnknownRateLimitClassError{ID: op.ID, Name: op.Name, Class: op.Policy.RateLimitClass})
+	}
+	return err
+}
+
+func NewPolicyEnforcer(cache graphql.Cache, opts ...PolicyOption) *PolicyEnforcer {
+	cfg := &policyConfig{limiters: make(map[string]*rate.Limiter)}
+	for _, o := range opts {
+		o(cfg)
+	}
+	return &PolicyEnforcer{cache: cache, limiters: cfg.limiters}
+}
+
+// PolicyEnforcer is a handler extension that enforces apollo.Policy of the persisted operations.
+type PolicyEnforcer struct {
+	cache    graphql.Cache
+	limiters map[string]*rate.Limiter
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+	graphql.OperationInterceptor
+} = (*PolicyEnforcer)(nil)
+
+func (*PolicyEnforcer) ExtensionName() string { return "PersistedQueryPolicyEnforcer" }
+
+func (e *PolicyEnforcer) Validate(graphql.ExecutableSchema) error {
+	if e.cache == nil {
+		return ErrNilCache
+	}
+	return nil
+}
+
+func (e *PolicyEnforcer) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	op := currentOperation(ctx, e.cache)
+	if op == nil || op.Policy == nil {
+		return nil
+	}
+	if isGETRequest(ctx) && rc.Operation != nil && rc.Operation.Operation != ast.Query {
+		return nil // refused by the GET transport, so it must not take a rate limit token
+	}
+	policy := op.Policy
+	if policy.IsDeprecated() {
+		if notice := deprecationNoticeFromContext(ctx); notice != nil {
+			notice.Deprecated = true
+			notice.Date = policy.DeprecatedAt
+			notice.Sunset = policy.Sunset
+		}
+		if policy.Sunset != nil && !time.Now().Before(*policy.Sunset) {
+			err := gqlerror.Errorf("the operation %s was sunset at %s", op.Name, policy.Sunset.Format(time.RFC3339))
+			errcode.Set(err, errOperationSunsetCode)
+			return err
+		}
+		slog.WarnContext(ctx, "deprecated persisted operation is executed", slog.String("operation.id", op.ID), slog.String("operation.name", op.Name))
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("graphql.persisted_operation.deprecated", true))
+	}
+	if policy.CacheTTL > 0 {
+		if hint := cacheHintFromContext(ctx); hint != nil {
+			hint.MaxAge = time.Duration(policy.CacheTTL)
+		}
+	}
+	if limiter, ok := e.limiters[policy.RateLimitClass]; ok && !limiter.Allow() {
+		err := gqlerror.Errorf("rate limit exceeded for the operation %s", op.Name)
+		errcode.Set(err, errRateLimitedCode)
+		return err
+	}
+	return nil
+}
+
+func (e *PolicyEnforcer) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	op := currentOperation(ctx, e.cache)
+	if op == nil || op.Policy == nil {
+		return next(ctx)
+	}
+	policy := op.Policy
+	isSubscription := graphql.GetOperationContext(ctx).Operation.Operation == ast.Subscription
+	var cancel context.CancelFunc
+	if policy.MaxExecutionTime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(policy.MaxExecutionTime))
+	}
+	handler := next(ctx)
+	return func(ctx context.Context) *graphql.Response {
+		resp := handler(ctx)
+		if cancel != nil && (resp == nil || !isSubscription) {
+			cancel()
+		}
+		if resp != nil && policy.IsDeprecated() {
+			addDeprecationWarning(resp, op.Name, policy)
+		}
+		return resp
+	}
+}
+
+func addDeprecationWarning(resp *graphql.Response, name string, policy *apollo.Policy) {
+	warning := map[string]any{
+		"message": fmt.Sprintf("the operation %s is deprecated", name),
+		"code":    warnDeprecatedCode,
+	}
+	if policy.DeprecatedAt != nil {
+		warning["deprecatedAt"] = policy.DeprecatedAt.Format(time.RFC3339)
+	}
+	if sunset := policy.Sunset; sunset != nil {
+		warning["message"] = fmt.Sprintf("the operation %s is deprecated and will be refused after %s", name, sunset.Format(time.RFC3339))
+		warning["sunset"] = sunset.Format(time.RFC3339)
+	}
+	if resp.Extensions == nil {
+		resp.Extensions = make(map[string]any)
+	}
+	warnings, _ := resp.Extensions["warnings"].([]any)
+	resp.Extensions["warnings"] = append(warnings, warning)
+}
+
+// CacheHint lets the extensions tell the HTTP layer how long the response can be cached.
+type CacheHint struct {
+	MaxAge time.Duration
+}
+
+type cacheHintCtxKey struct{}
+
+func WithCacheHint(ctx context.Context) (context.Context, *CacheHint) {
+	hint := new(CacheHint)
+	return context.WithValue(ctx, cacheHintCtxKey{}, hint), hint
+}
+
+func cacheHintFromContext(ctx context.Context) *CacheHint {
+	hint, _ := ctx.Value(cacheHintCtxKey{}).(*CacheHint)
+	return hint
+}
+
+// DeprecationNotice lets the extensions tell the HTTP layer that the operation is deprecated.
+type DeprecationNotice struct {
+	Deprecated bool
+	// Date is the deprecation date if the manifest declares it.
+	Date   *time.Time
+	Sunset *time.Time
+}
+
+type deprecationNoticeCtxKey struct{}
+
+func WithDeprecationNotice(ctx context.Context) (context.Context, *DeprecationNotice) {
+	notice := new(DeprecationNotice)
+	return context.WithValue(ctx, deprecationNoticeCtxKey{}, notice), notice
+}
+
+func deprecationNoticeFromContext(ctx context.Context) *DeprecationNotice {
+	notice, _ := ctx.Value(deprecationNoticeCtxKey{}).(*DeprecationNotice)
+	return notice
+}
@@ -0,0 +1,95 @@
+package persistedquery
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// operationContextFor returns the context of the resolved persisted operation as the handler would build.
+func operationContextFor(method string, op *apollo.Operation, operation ast.Operation) (context.Context, *graphql.OperationContext) {
+	rc := &graphql.OperationContext{Operation: &ast.OperationDefinition{Operation: operation}}
+	rc.Stats.SetExtension(statsExtension, &Stats{ID: op.ID, Operation: op})
+	ctx := context.WithValue(context.Background(), requestMethodCtxKey{}, method)
+	return graphql.WithOperationContext(ctx, rc), rc
+}
+
+func TestPolicyEnforcer_rateLimit(t *testing.T) {
+	query := &apollo.Operation{ID: "q", Name: "Q", Policy: &apollo.Policy{RateLimitClass: "limited"}}
+	mutation := &apollo.Operation{ID: "m", Name: "M", Policy: &apollo.Policy{RateLimitClass: "limited"}}
+	steps := []struct {
+		name      string
+		method    string
+		op        *apollo.Operation
+		operation ast.Operation
+		wantCode  string
+	}{
+		{name: "mutation on GET is left to the transport", method: http.MethodGet, op: mutation, operation: ast.Mutation},
+		{name: "mutation on GET again", method: http.MethodGet, op: mutation, operation: ast.Mutation},
+		{name: "query on GET takes the token", method: http.MethodGet, op: query, operation: ast.Query},
+		{name: "mutation on POST is limited", method: http.MethodPost, op: mutation, operation: ast.Mutation, wantCode: errRateLimitedCode},
+	}
+	enforcer := NewPolicyEnforcer(apollo.New(&apollo.Manifest{}), WithRateLimit("limited", 0, 1))
+	for _, step := range steps {
+		ctx, rc := operationContextFor(step.method, step.op, step.operation)
+		err := enforcer.MutateOperationContext(ctx, rc)
+		var gotCode string
+		if err != nil {
+			gotCode, _ = err.Extensions["code"].(string)
+		}
+		if gotCode != step.wantCode {
+			t.Errorf("%s: want %q, got %v", step.name, step.wantCode, err)
+		}
+	}
+}
+
+func TestValidateRateLimitClasses(t *testing.T) {
+	manifest := &apollo.Manifest{Operations: []apollo.Operation{
+		{ID: "1", Name: "Unlimited"},
+		{ID: "2", Name: "NoClass", Policy: &apollo.Policy{Deprecated: true}},
+		{ID: "3", Name: "Configured", Policy: &apollo.Policy{RateLimitClass: "expensive"}},
+		{ID: "4", Name: "Typo", Policy: &apollo.Policy{RateLimitClass: "expnsive"}},
+	}}
+	cases := []struct {
+		name    string
+		classes []string
+		wantOps []string
+	}{
+		{name: "configured", classes: []string{"expensive", "expnsive"}},
+		{name: "typo", classes: []string{"expensive"}, wantOps: []string{"Typo"}},
+		{name: "no classes configured", wantOps: []string{"Configured", "Typo"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateRateLimitClasses(manifest, c.classes)
+			var got []string
+			for _, e := range flattenErrors(err) {
+				got = append(got, e.(*UnknownRateLimitClassError).Name)
+			}
+			if !slices.Equal(got, c.wantOps) {
+				t.Errorf("want %v, got %v", c.wantOps, got)
+			}
+		})
+	}
+}
+
+// flattenErrors returns the errors joined by errors.Join in order.
+func flattenErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, flattenErrors(e)...)
+	}
+	return errs
+}
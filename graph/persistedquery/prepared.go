@@ -0,0 +1,75 @@
+package persistedquery
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// DocumentLookup is implemented by caches that keep the parsed and validated documents of their operations.
+type DocumentLookup interface {
+	LookupDocument(ctx context.Context, query string) (*ast.QueryDocument, bool)
+}
+
+func lookupDocument(ctx context.Context, cache graphql.Cache, query string) (*ast.QueryDocument, bool) {
+	l, ok := cache.(DocumentLookup)
+	if !ok {
+		return nil, false
+	}
+	return l.LookupDocument(ctx, query)
+}
+
+// NewPreparedList validates the manifest against the schema and returns the query list that keeps the validated documents.
+func NewPreparedList(schema *ast.Schema, manifest *apollo.Manifest) (*PreparedList, error) {
+	documents, err := prepareManifest(schema, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &PreparedList{Cache: apollo.New(manifest), documents: documents}, nil
+}
+
+type PreparedList struct {
+	graphql.Cache
+	documents map[string]*ast.QueryDocument
+}
+
+var (
+	_ OperationLookup = (*PreparedList)(nil)
+	_ AliasLookup     = (*PreparedList)(nil)
+	_ DocumentLookup  = (*PreparedList)(nil)
+)
+
+func (l *PreparedList) LookupOperation(ctx context.Context, id string) (*apollo.Operation, bool) {
+	return lookupOperation(ctx, l.Cache, id)
+}
+
+func (l *PreparedList) LookupAlias(ctx context.Context, id string) (*apollo.Alias, bool) {
+	return lookupAlias(ctx, l.Cache, id)
+}
+
+func (l *PreparedList) LookupDocument(_ context.Context, query string) (*ast.QueryDocument, bool) {
+	doc, ok := l.documents[query]
+	return doc, ok
+}
+
+// DocumentCache is a graphql.Cache for handler.SetQueryCache that serves the documents prepared by the query list,
+// so that persisted operations skip parsing and validation.
+//
+// Other queries are never added because clients may send arbitrary ones.
+type DocumentCache struct {
+	Cache graphql.Cache
+}
+
+var _ graphql.Cache = DocumentCache{}
+
+func (c DocumentCache) Get(ctx context.Context, query string) (any, bool) {
+	doc, ok := lookupDocument(ctx, c.Cache, query)
+	if !ok {
+		return nil, false
+	}
+	return doc, true
+}
+
+func (DocumentCache) Add(context.Context, string, any) {}
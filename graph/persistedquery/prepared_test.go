@@ -0,0 +1,60 @@
+package persistedquery_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/executor"
+	"github.com/aereal/poc-graphql-pqs-server/graph"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/aereal/poc-graphql-pqs-server/graph/resolvers"
+)
+
+const benchmarkQuery = `query Characters($first: UnsignedInt!) {
+  characters(first: $first) {
+    nodes {
+      name
+      element
+    }
+  }
+}`
+
+// BenchmarkCreateOperationContext measures the parse and validation that DocumentCache saves per request.
+func BenchmarkCreateOperationContext(b *testing.B) {
+	es := graph.NewExecutableSchema(graph.Config{Resolvers: resolvers.New()})
+	manifest := &apollo.Manifest{
+		Format:     apollo.SupportedFormat,
+		Version:    apollo.SupportedVersion,
+		Operations: []apollo.Operation{{ID: apollo.ComputeID(benchmarkQuery), Name: "Characters", Type: "query", Body: benchmarkQuery}},
+	}
+	list, err := persistedquery.NewPreparedList(es.Schema(), manifest)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cases := []struct {
+		name       string
+		queryCache graphql.Cache
+	}{
+		{name: "without DocumentCache"},
+		{name: "with DocumentCache", queryCache: persistedquery.DocumentCache{Cache: list}},
+	}
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			exec := executor.New(es)
+			if c.queryCache != nil {
+				exec.SetQueryCache(c.queryCache)
+			}
+			ctx := graphql.StartOperationTrace(context.Background())
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				params := &graphql.RawParams{Query: benchmarkQuery, OperationName: "Characters", Variables: map[string]any{"first": 10}}
+				if _, errs := exec.CreateOperationContext(ctx, params); errs != nil {
+					b.Fatal(errs)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+)
+
+const Format = "relay"
+
+// Detect reports whether the data looks like a Relay persisted query map, which is a flat JSON object from IDs to query bodies.
+func Detect(data []byte) bool {
+	var queryMap map[string]string
+	return json.Unmarshal(data, &queryMap) == nil
+}
+
+// Decode converts a Relay persisted query map into a manifest.
+//
+// Relay IDs are not SHA-256 hashes of the bodies, so they are kept as-is and never verified.
+func Decode(data []byte) (*apollo.Manifest, error) {
+	var queryMap map[string]string
+	if err := json.Unmarshal(data, &queryMap); err != nil {
+		return nil, fmt.Errorf("failed to decode relay query map: %w", err)
+	}
+	ids := make([]string, 0, len(queryMap))
+	for id := range queryMap {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	manifest := &apollo.Manifest{Format: apollo.SupportedFormat, Version: apollo.SupportedVersion, Operations: make([]apollo.Operation, 0, len(ids))}
+	for _, id := range ids {
+		op, err := apollo.NewOperation(id, queryMap[id])
+		if err != nil {
+			return nil, err
+		}
+		manifest.Operations = append(manifest.Operations, op)
+	}
+	if err := apollo.ValidateOperations(manifest.Operations, apollo.WithoutIDVerification()); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,186 @@
+package persistedquery
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const defaultPollInterval = time.Second * 5
+
+var (
+	ErrNilQueryList = errors.New("loaded query list is nil")
+	// ErrNotModified is returned by LoadFunc when the source has not changed since the last load.
+	ErrNotModified = errors.New("query list is not modified")
+)
+
+type LoadFunc func(ctx context.Context) (graphql.Cache, error)
+
+func NewReloadableList(ctx context.Context, load LoadFunc) (*ReloadableList, error) {
+	l := &ReloadableList{load: load}
+	if err := l.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ReloadableList is a graphql.Cache that delegates to the most recently loaded query list.
+//
+// Requests that already looked up a query keep using the body they got, so swapping the list never affects in-flight requests.
+type ReloadableList struct {
+	load    LoadFunc
+	current atomic.Pointer[loadedList]
+}
+
+type loadedList struct{ graphql.Cache }
+
+var _ graphql.Cache = (*ReloadableList)(nil)
+
+func (l *ReloadableList) Get(ctx context.Context, key string) (any, bool) {
+	return l.current.Load().Get(ctx, key)
+}
+
+func (*ReloadableList) Add(context.Context, string, any) {}
+
+var _ OperationLookup = (*ReloadableList)(nil)
+
+func (l *ReloadableList) LookupOperation(ctx context.Context, id string) (*apollo.Operation, bool) {
+	return lookupOperation(ctx, l.current.Load().Cache, id)
+}
+
+var _ AliasLookup = (*ReloadableList)(nil)
+
+func (l *ReloadableList) LookupAlias(ctx context.Context, id string) (*apollo.Alias, bool) {
+	return lookupAlias(ctx, l.current.Load().Cache, id)
+}
+
+var _ DocumentLookup = (*ReloadableList)(nil)
+
+func (l *ReloadableList) LookupDocument(ctx context.Context, query string) (*ast.QueryDocument, bool) {
+	return lookupDocument(ctx, l.current.Load().Cache, query)
+}
+
+// Reload loads a new query list and swaps it in.
+// The current list keeps serving if loading fails, including when it fails with ErrNotModified.
+func (l *ReloadableList) Reload(ctx context.Context) error {
+	list, err := l.load(ctx)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return ErrNilQueryList
+	}
+	l.current.Store(&loadedList{list})
+	return nil
+}
+
+type watchConfig struct {
+	file         string
+	pollInterval time.Duration
+	signals      []os.Signal
+}
+
+type WatchOption func(*watchConfig)
+
+// WithWatchFile watches the file, the files in the directory, or the files matched by the glob pattern.
+func WithWatchFile(file string) WatchOption { return func(c *watchConfig) { c.file = file } }
+
+func WithPollInterval(d time.Duration) WatchOption {
+	return func(c *watchConfig) { c.pollInterval = d }
+}
+
+func WithReloadSignals(signals ...os.Signal) WatchOption {
+	return func(c *watchConfig) { c.signals = signals }
+}
+
+// Watch reloads the list whenever the watched file is modified or one of the reload signals is received.
+// It blocks until ctx is done.
+func (l *ReloadableList) Watch(ctx context.Context, opts ...WatchOption) {
+	cfg := &watchConfig{pollInterval: defaultPollInterval, signals: []os.Signal{syscall.SIGHUP}}
+	for _, o := range opts {
+		o(cfg)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	if len(cfg.signals) > 0 {
+		signal.Notify(sigCh, cfg.signals...)
+		defer signal.Stop(sigCh)
+	}
+	var tickCh <-chan time.Time
+	var lastModTime time.Time
+	if cfg.file != "" {
+		if modTime, err := latestModTime(cfg.file); err == nil {
+			lastModTime = modTime
+		}
+		ticker := time.NewTicker(cfg.pollInterval)
+		defer ticker.Stop()
+		tickCh = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigCh:
+			l.reloadAndLog(ctx, slog.String("trigger", sig.String()))
+		case <-tickCh:
+			modTime, err := latestModTime(cfg.file)
+			if err != nil {
+				slog.WarnContext(ctx, "cannot stat watched file", slog.String("file", cfg.file), slog.String("error", err.Error()))
+				continue
+			}
+			if modTime.Equal(lastModTime) {
+				continue
+			}
+			lastModTime = modTime
+			l.reloadAndLog(ctx, slog.String("trigger", "file"), slog.String("file", cfg.file))
+		}
+	}
+}
+
+func (l *ReloadableList) reloadAndLog(ctx context.Context, attrs ...any) {
+	err := l.Reload(ctx)
+	if errors.Is(err, ErrNotModified) {
+		slog.DebugContext(ctx, "query list is not modified", attrs...)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to reload query list; keep serving the last one", append(attrs, slog.String("error", err.Error()))...)
+		return
+	}
+	slog.InfoContext(ctx, "query list reloaded", attrs...)
+}
+
+func latestModTime(path string) (time.Time, error) {
+	var latest time.Time
+	if fi, err := os.Stat(path); err == nil {
+		latest = fi.ModTime() // directory mtime changes when files are added or removed
+	}
+	files, err := manifestFiles(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+		// signature files are usually written after the manifest
+		if fi, err := os.Stat(file + SignatureFileSuffix); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
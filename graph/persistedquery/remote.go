@@ -0,0 +1,244 @@
+package persistedquery
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+const (
+	defaultRemotePollInterval = time.Second * 30
+	defaultRemoteMaxBackoff   = time.Minute * 10
+	defaultRemoteFetchTimeout = time.Second * 30
+	maxRemoteManifestSize     = 32 << 20
+)
+
+type remoteConfig struct {
+	client       *http.Client
+	cacheFile    string
+	pollInterval time.Duration
+	maxBackoff   time.Duration
+	fetchTimeout time.Duration
+	trustedKeys  []ed25519.PublicKey
+}
+
+type RemoteOption func(*remoteConfig)
+
+func WithHTTPClient(client *http.Client) RemoteOption {
+	return func(c *remoteConfig) { c.client = client }
+}
+
+// WithCacheFile keeps the last good manifest in the file and loads it when the remote is unavailable at startup.
+func WithCacheFile(file string) RemoteOption { return func(c *remoteConfig) { c.cacheFile = file } }
+
+func WithRemotePollInterval(d time.Duration) RemoteOption {
+	return func(c *remoteConfig) { c.pollInterval = d }
+}
+
+// WithMaxBackoff caps the interval that grows while fetching or loading the manifest keeps failing.
+func WithMaxBackoff(d time.Duration) RemoteOption { return func(c *remoteConfig) { c.maxBackoff = d } }
+
+// WithFetchTimeout bounds the time of fetching the manifest and its signature.
+func WithFetchTimeout(d time.Duration) RemoteOption {
+	return func(c *remoteConfig) { c.fetchTimeout = d }
+}
+
+// WithRemoteTrustedKeys requires the detached signature served at the manifest URL with SignatureFileSuffix appended.
+func WithRemoteTrustedKeys(keys ...ed25519.PublicKey) RemoteOption {
+	return func(c *remoteConfig) { c.trustedKeys = keys }
+}
+
+func NewRemoteManifest(manifestURL string, opts ...RemoteOption) *RemoteManifest {
+	cfg := &remoteConfig{client: http.DefaultClient, pollInterval: defaultRemotePollInterval, maxBackoff: defaultRemoteMaxBackoff, fetchTimeout: defaultRemoteFetchTimeout}
+	for _, o := range opts {
+		o(cfg)
+	}
+	return &RemoteManifest{url: manifestURL, cfg: cfg}
+}
+
+// RemoteManifest fetches the manifest from an HTTP(S) URL with conditional requests.
+type RemoteManifest struct {
+	url string
+	cfg *remoteConfig
+
+	mu   sync.Mutex
+	etag string // of the last accepted manifest
+	// loaded tells whether a manifest has been loaded either from the remote or from the cache file.
+	// The cache file is loaded only at cold start, so that later fetch errors are reported and backed off.
+	loaded bool
+}
+
+// Loader returns the LoadFunc that builds the query list from the fetched manifest.
+//
+// The manifest is accepted only if build succeeds: its ETag is used for the next request and it is saved to the cache file.
+// The LoadFunc fails with ErrNotModified while the manifest is unchanged.
+func (r *RemoteManifest) Loader(build func(ctx context.Context, data []byte) (graphql.Cache, error)) LoadFunc {
+	return func(ctx context.Context) (graphql.Cache, error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		fetchCtx, cancel := context.WithTimeout(ctx, r.cfg.fetchTimeout)
+		data, signature, etag, err := r.fetch(fetchCtx)
+		cancel()
+		var list graphql.Cache
+		if err == nil {
+			list, err = build(ctx, data)
+		}
+		// a manifest that cannot be fetched, verified or built must not keep the server from starting while the cached one is usable
+		if err != nil && !r.loaded && r.cfg.cacheFile != "" && !errors.Is(err, ErrNotModified) {
+			slog.WarnContext(ctx, "failed to load remote manifest; load the cached one", slog.String("url", r.url), slog.String("file", r.cfg.cacheFile), slog.String("error", err.Error()))
+			list, err := r.loadCacheFile(ctx, build)
+			if err != nil {
+				return nil, err
+			}
+			r.loaded = true
+			return list, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.etag = etag
+		r.loaded = true
+		if r.cfg.cacheFile != "" {
+			if err := r.saveCacheFile(data, signature); err != nil {
+				slog.WarnContext(ctx, "failed to save remote manifest to the cache file", slog.String("file", r.cfg.cacheFile), slog.String("error", err.Error()))
+			}
+		}
+		return list, nil
+	}
+}
+
+func (r *RemoteManifest) fetch(ctx context.Context) (data, signature []byte, etag string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to build request: %w", err)
+	}
+	if r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	resp, err := r.cfg.client.Do(req)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil, "", ErrNotModified
+	default:
+		return nil, nil, "", fmt.Errorf("failed to fetch manifest: unexpected status %s", resp.Status)
+	}
+	data, err = io.ReadAll(io.LimitReader(resp.Body, maxRemoteManifestSize))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if len(r.cfg.trustedKeys) > 0 {
+		signature, err = r.fetchSignature(ctx)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if err := VerifyManifestSignature(r.cfg.trustedKeys, data, signature); err != nil {
+			return nil, nil, "", err
+		}
+	}
+	return data, signature, resp.Header.Get("ETag"), nil
+}
+
+func (r *RemoteManifest) fetchSignature(ctx context.Context) ([]byte, error) {
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest URL: %w", err)
+	}
+	u.Path += SignatureFileSuffix
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	resp, err := r.cfg.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signature: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch signature: unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1024))
+}
+
+func (r *RemoteManifest) loadCacheFile(ctx context.Context, build func(ctx context.Context, data []byte) (graphql.Cache, error)) (graphql.Cache, error) {
+	data, err := os.ReadFile(r.cfg.cacheFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache file: %w", err)
+	}
+	if len(r.cfg.trustedKeys) > 0 {
+		signature, err := os.ReadFile(r.cfg.cacheFile + SignatureFileSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signature file: %w", err)
+		}
+		if err := VerifyManifestSignature(r.cfg.trustedKeys, data, signature); err != nil {
+			return nil, err
+		}
+	}
+	// the ETag stays empty so that the next fetch gets the latest manifest
+	return build(ctx, data)
+}
+
+func (r *RemoteManifest) saveCacheFile(data, signature []byte) error {
+	if signature != nil {
+		if err := writeFileAtomically(r.cfg.cacheFile+SignatureFileSuffix, signature); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomically(r.cfg.cacheFile, data)
+}
+
+func writeFileAtomically(file string, data []byte) error {
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// Watch reloads the list at the poll interval. The interval doubles up to the max backoff while reloading fails.
+// It blocks until ctx is done.
+func (r *RemoteManifest) Watch(ctx context.Context, list *ReloadableList) {
+	wait := r.cfg.pollInterval
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		err := list.Reload(ctx)
+		wait = r.nextWait(wait, err)
+		switch {
+		case errors.Is(err, ErrNotModified):
+		case err != nil:
+			slog.ErrorContext(ctx, "failed to reload remote manifest; keep serving the last one", slog.String("url", r.url), slog.Duration("retry_after", wait), slog.String("error", err.Error()))
+		default:
+			slog.InfoContext(ctx, "query list reloaded", slog.String("trigger", "remote"), slog.String("url", r.url))
+		}
+		timer.Reset(wait)
+	}
+}
+
+// nextWait returns the interval until the next reload by the result of the last one.
+func (r *RemoteManifest) nextWait(current time.Duration, err error) time.Duration {
+	if err != nil && !errors.Is(err, ErrNotModified) {
+		return min(current*2, r.cfg.maxBackoff)
+	}
+	return r.cfg.pollInterval
+}
@@ -0,0 +1,200 @@
+package persistedquery
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+)
+
+func buildTestList(_ context.Context, data []byte) (graphql.Cache, error) {
+	manifest, err := DecodeManifest(data)
+	if err != nil {
+		return nil, err
+	}
+	return apollo.New(manifest), nil
+}
+
+func testManifest(t *testing.T, bodies ...string) []byte {
+	t.Helper()
+	manifest := &apollo.Manifest{Format: apollo.SupportedFormat, Version: apollo.SupportedVersion}
+	for i, body := range bodies {
+		manifest.Operations = append(manifest.Operations, apollo.Operation{ID: apollo.ComputeID(body), Name: string(rune('A' + i)), Type: "query", Body: body})
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// manifestServer serves the manifest with the ETag and answers conditional requests.
+type manifestServer struct {
+	mu       sync.Mutex
+	data     []byte
+	etag     string
+	status   int // overrides the response if not zero
+	requests int
+}
+
+func (s *manifestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	if r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	_, _ = w.Write(s.data)
+}
+
+func (s *manifestServer) set(data []byte, etag string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data, s.etag, s.status = data, etag, status
+}
+
+func TestRemoteManifest_Loader(t *testing.T) {
+	oldBody := "query A { __typename }"
+	newBody := "query A { __schema { queryType { name } } }"
+	srv := &manifestServer{}
+	srv.set(testManifest(t, oldBody), `"v1"`, 0)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	cacheFile := filepath.Join(t.TempDir(), "manifest.json")
+	load := NewRemoteManifest(ts.URL, WithCacheFile(cacheFile)).Loader(buildTestList)
+	ctx := context.Background()
+
+	list, err := load(ctx)
+	if err != nil {
+		t.Fatalf("first load: %v", err)
+	}
+	if _, ok := list.Get(ctx, apollo.ComputeID(oldBody)); !ok {
+		t.Error("first load: the operation is not found")
+	}
+	if cached, err := os.ReadFile(cacheFile); err != nil || len(cached) == 0 {
+		t.Errorf("the cache file is not written: %v", err)
+	}
+
+	if _, err := load(ctx); !errors.Is(err, ErrNotModified) {
+		t.Fatalf("second load: want ErrNotModified, got %v", err)
+	}
+
+	srv.set(testManifest(t, newBody), `"v2"`, 0)
+	list, err = load(ctx)
+	if err != nil {
+		t.Fatalf("load after the change: %v", err)
+	}
+	if _, ok := list.Get(ctx, apollo.ComputeID(newBody)); !ok {
+		t.Error("load after the change: the new operation is not found")
+	}
+	if _, ok := list.Get(ctx, apollo.ComputeID(oldBody)); ok {
+		t.Error("load after the change: the old operation is still found")
+	}
+	if srv.requests != 3 {
+		t.Errorf("requests: want 3, got %d", srv.requests)
+	}
+}
+
+func TestRemoteManifest_Loader_cacheFileFallback(t *testing.T) {
+	body := "query A { __typename }"
+	cached := testManifest(t, body)
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name   string
+		data   []byte
+		status int
+		opts   []RemoteOption
+	}{
+		{name: "unavailable", status: http.StatusServiceUnavailable},
+		{name: "malformed manifest", data: []byte("{")},
+		{name: "invalid manifest", data: []byte("{}")},
+		// the server answers the manifest for the signature URL as well, which is not a valid signature
+		{name: "unverified manifest", data: testManifest(t, "query B { __typename }"), opts: []RemoteOption{WithRemoteTrustedKeys(publicKey)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := &manifestServer{}
+			srv.set(c.data, `"v1"`, c.status)
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+			cacheFile := filepath.Join(t.TempDir(), "manifest.json")
+			if err := os.WriteFile(cacheFile, cached, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(cacheFile+SignatureFileSuffix, SignManifest(privateKey, cached), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			load := NewRemoteManifest(ts.URL, append(c.opts, WithCacheFile(cacheFile))...).Loader(buildTestList)
+			ctx := context.Background()
+
+			list, err := load(ctx)
+			if err != nil {
+				t.Fatalf("cold start: %v", err)
+			}
+			if _, ok := list.Get(ctx, apollo.ComputeID(body)); !ok {
+				t.Error("cold start: the cached operation is not found")
+			}
+			if _, err := load(ctx); err == nil || errors.Is(err, ErrNotModified) {
+				t.Errorf("load after the cold start: want an error, got %v", err)
+			}
+			if data, err := os.ReadFile(cacheFile); err != nil || !bytes.Equal(data, cached) {
+				t.Errorf("the cache file is overwritten: %v", err)
+			}
+		})
+	}
+}
+
+func TestRemoteManifest_Loader_noCacheFile(t *testing.T) {
+	srv := &manifestServer{}
+	srv.set(nil, "", http.StatusInternalServerError)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	load := NewRemoteManifest(ts.URL).Loader(buildTestList)
+	if _, err := load(context.Background()); err == nil {
+		t.Error("want an error")
+	}
+}
+
+func TestRemoteManifest_nextWait(t *testing.T) {
+	r := NewRemoteManifest("http://example.com/", WithRemotePollInterval(time.Second), WithMaxBackoff(time.Second*5))
+	errFetch := errors.New("fetch error")
+	steps := []struct {
+		err  error
+		want time.Duration
+	}{
+		{err: errFetch, want: time.Second * 2},
+		{err: errFetch, want: time.Second * 4},
+		{err: errFetch, want: time.Second * 5},
+		{err: errFetch, want: time.Second * 5},
+		{err: ErrNotModified, want: time.Second},
+		{err: errFetch, want: time.Second * 2},
+		{err: nil, want: time.Second},
+	}
+	wait := time.Second
+	for i, step := range steps {
+		wait = r.nextWait(wait, step.err)
+		if wait != step.want {
+			t.Errorf("#%d: want %s, got %s", i, step.want, wait)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package persistedquery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	errPersistedQueryNotFound         = "PersistedQueryNotFound"
+	errPersistedQueryNotFoundCode     = "PERSISTED_QUERY_NOT_FOUND"
+	errPersistedQueryNotSupported     = "PersistedQueryNotSupported"
+	errPersistedQueryNotSupportedCode = "PERSISTED_QUERY_NOT_SUPPORTED"
+	errPersistedQueryMismatchCode     = "PERSISTED_QUERY_MISMATCH"
+	errPersistedQueryUnavailable      = "PersistedQueryUnavailable"
+	errPersistedQueryUnavailableCode  = "PERSISTED_QUERY_UNAVAILABLE"
+
+	statsExtension = "PersistedQuery"
+)
+
+var ErrNilCache = errors.New("persisted query cache must not be nil")
+
+// Safelist is a handler extension that only allows the operations registered in the Cache.
+//
+// Unlike extension.AutomaticPersistedQuery, it never runs a query that is not registered and never registers new queries.
+type Safelist struct {
+	Cache graphql.Cache
+	// Capturer, if set, receives the queries rejected because they are not registered.
+	Capturer UnknownOperationCapturer
+}
+
+type Stats struct {
+	// ID is the persisted query ID that the request referred to.
+	ID string
+	// Operation is the persisted operation with its metadata, or nil if the cache does not implement OperationLookup.
+	Operation *apollo.Operation
+}
+
+var _ interface {
+	graphql.OperationParameterMutator
+	graphql.HandlerExtension
+} = Safelist{}
+
+func (Safelist) ExtensionName() string { return "PersistedQuerySafelist" }
+
+func (s Safelist) Validate(graphql.ExecutableSchema) error {
+	if s.Cache == nil {
+		return ErrNilCache
+	}
+	return nil
+}
+
+func (s Safelist) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	if GetStats(ctx) != nil { // already resolved by another extension such as PersistedDocument
+		return nil
+	}
+	if err := validateClient(ctx, s.Cache); err != nil {
+		return err
+	}
+	hash := persistedQueryHash(rawParams)
+	if hash == "" {
+		// clients that have not adopted persisted queries send the raw query, which is also worth a review
+		if rawParams.Query != "" {
+			s.captureRawQuery(ctx, rawParams.Query)
+		}
+		return newNotSupportedError()
+	}
+	err := resolve(ctx, s.Cache, hash, rawParams)
+	if err != nil && s.Capturer != nil && rawParams.Query != "" && isNotFoundError(err) {
+		s.Capturer.CaptureUnknownOperation(ctx, hash, rawParams.Query)
+	}
+	return err
+}
+
+// persistedQueryHash returns the hash in the persistedQuery extension of the supported version, or an empty string.
+func persistedQueryHash(rawParams *graphql.RawParams) string {
+	ext, ok := rawParams.Extensions["persistedQuery"].(map[string]any)
+	if !ok {
+		return ""
+	}
+	if version, ok := asInt(ext["version"]); !ok || version != 1 {
+		return ""
+	}
+	hash, _ := ext["sha256Hash"].(string)
+	return hash
+}
+
+// captureRawQuery captures the query sent without its hash unless it is already registered.
+func (s Safelist) captureRawQuery(ctx context.Context, query string) {
+	if s.Capturer == nil {
+		return
+	}
+	id := apollo.ComputeID(query)
+	if _, err := lookupQuery(ctx, s.Cache, id); errors.Is(err, ErrQueryNotFound) {
+		s.Capturer.CaptureUnknownOperation(ctx, id, query)
+	}
+}
+
+func resolve(ctx context.Context, cache graphql.Cache, id string, rawParams *graphql.RawParams) *gqlerror.Error {
+	if err := validateClient(ctx, cache); err != nil {
+		return err
+	}
+	body, err := lookupQuery(ctx, cache, id)
+	if errors.Is(err, ErrQueryNotFound) {
+		return newNotFoundError()
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "failed to look up persisted query", slog.String("id", id), slog.String("error", err.Error()))
+		return newUnavailableError()
+	}
+	if rawParams.Query != "" && rawParams.Query != body && !isAliasedQuery(ctx, cache, id, rawParams.Query) {
+		err := gqlerror.Errorf("provided query does not match the persisted query")
+		errcode.Set(err, errPersistedQueryMismatchCode)
+		return err
+	}
+	rawParams.Query = body
+	stats := &Stats{ID: id}
+	stats.Operation, _ = lookupOperation(ctx, cache, id)
+	graphql.GetOperationContext(ctx).Stats.SetExtension(statsExtension, stats)
+	return nil
+}
+
+// isAliasedQuery reports whether the query is the retired body of the alias, which clients may still send along with the ID.
+func isAliasedQuery(ctx context.Context, cache graphql.Cache, id, query string) bool {
+	_, ok := lookupAlias(ctx, cache, id)
+	return ok && apollo.ComputeID(query) == id
+}
+
+// GetStats returns the persisted query stats of the current operation, or nil if the operation is not a persisted one.
+func GetStats(ctx context.Context) *Stats {
+	if !graphql.HasOperationContext(ctx) {
+		return nil
+	}
+	s, _ := graphql.GetOperationContext(ctx).Stats.GetExtension(statsExtension).(*Stats)
+	return s
+}
+
+func newNotFoundError() *gqlerror.Error {
+	err := gqlerror.Errorf(errPersistedQueryNotFound)
+	errcode.Set(err, errPersistedQueryNotFoundCode)
+	return err
+}
+
+func isNotFoundError(err *gqlerror.Error) bool {
+	return err.Extensions["code"] == errPersistedQueryNotFoundCode
+}
+
+// newUnavailableError tells that the query cannot be looked up for now, so it must not be treated as an unknown query.
+func newUnavailableError() *gqlerror.Error {
+	err := gqlerror.Errorf(errPersistedQueryUnavailable)
+	errcode.Set(err, errPersistedQueryUnavailableCode)
+	return err
+}
+
+func newNotSupportedError() *gqlerror.Error {
+	err := gqlerror.Errorf(errPersistedQueryNotSupported)
+	errcode.Set(err, errPersistedQueryNotSupportedCode)
+	return err
+}
+
+func asInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	case float64:
+		return int64(v), float64(int64(v)) == v
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,223 @@
+package persistedquery_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/aereal/poc-graphql-pqs-server/graph"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/aereal/poc-graphql-pqs-server/graph/resolvers"
+)
+
+func newTestSchema() graphql.ExecutableSchema {
+	return graph.NewExecutableSchema(graph.Config{Resolvers: resolvers.New()})
+}
+
+func newTestManifest(ops ...apollo.Operation) *apollo.Manifest {
+	for i := range ops {
+		if ops[i].ID == "" {
+			ops[i].ID = apollo.ComputeID(ops[i].Body)
+		}
+		if ops[i].Type == "" {
+			ops[i].Type = "query"
+		}
+	}
+	return &apollo.Manifest{Format: apollo.SupportedFormat, Version: apollo.SupportedVersion, Operations: ops}
+}
+
+func newTestList(t *testing.T, es graphql.ExecutableSchema, ops ...apollo.Operation) *persistedquery.PreparedList {
+	t.Helper()
+	list, err := persistedquery.NewPreparedList(es.Schema(), newTestManifest(ops...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// newStrictHandler builds the public endpoint in the strict safelist mode as web does.
+func newStrictHandler(es graphql.ExecutableSchema, cache graphql.Cache) http.Handler {
+	h := handler.New(es)
+	h.AddTransport(persistedquery.DocumentIDTransport{Transport: transport.GET{}})
+	h.AddTransport(persistedquery.DocumentIDTransport{Transport: transport.POST{}})
+	h.SetQueryCache(persistedquery.DocumentCache{Cache: cache})
+	h.Use(persistedquery.ClientCheck{Cache: cache})
+	h.Use(persistedquery.PersistedDocument{Cache: cache})
+	h.Use(persistedquery.AliasedQuery{Cache: cache})
+	h.Use(persistedquery.Safelist{Cache: cache})
+	return persistedquery.ClientInfoMiddleware(h)
+}
+
+type testResponse struct {
+	Data   map[string]any `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func (r testResponse) errorCode() string {
+	if len(r.Errors) == 0 {
+		return ""
+	}
+	code, _ := r.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+func persistedQueryParams(hash string) map[string]any {
+	return map[string]any{"extensions": map[string]any{"persistedQuery": map[string]any{"version": 1, "sha256Hash": hash}}}
+}
+
+func postGraphQL(t *testing.T, h http.Handler, params map[string]any, header http.Header) testResponse {
+	t.Helper()
+	body, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return serveGraphQL(t, h, req)
+}
+
+func getGraphQL(t *testing.T, h http.Handler, params map[string]any, header http.Header) testResponse {
+	t.Helper()
+	query := url.Values{}
+	for name, value := range params {
+		if s, ok := value.(string); ok {
+			query.Set(name, s)
+			continue
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query.Set(name, string(b))
+	}
+	req := httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return serveGraphQL(t, h, req)
+}
+
+func serveGraphQL(t *testing.T, h http.Handler, req *http.Request) testResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var resp testResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response (status=%d): %v: %s", rec.Code, err, rec.Body.String())
+	}
+	return resp
+}
+
+func TestSafelist(t *testing.T) {
+	es := newTestSchema()
+	registered := "query Typename { __typename }"
+	unregistered := "query Schema { __schema { queryType { name } } }"
+	list := newTestList(t, es, apollo.Operation{Name: "Typename", Body: registered})
+	h := newStrictHandler(es, list)
+
+	withQuery := func(hash, query string) map[string]any {
+		params := persistedQueryParams(hash)
+		params["query"] = query
+		return params
+	}
+	cases := []struct {
+		name     string
+		params   map[string]any
+		wantCode string
+	}{
+		{name: "registered hash", params: persistedQueryParams(apollo.ComputeID(registered))},
+		{name: "registered hash with its body", params: withQuery(apollo.ComputeID(registered), registered)},
+		{name: "unknown hash", params: persistedQueryParams(apollo.ComputeID(unregistered)), wantCode: "PERSISTED_QUERY_NOT_FOUND"},
+		{name: "unknown hash with its body", params: withQuery(apollo.ComputeID(unregistered), unregistered), wantCode: "PERSISTED_QUERY_NOT_FOUND"},
+		{name: "registered hash with another body", params: withQuery(apollo.ComputeID(registered), unregistered), wantCode: "PERSISTED_QUERY_MISMATCH"},
+		{name: "raw query", params: map[string]any{"query": unregistered}, wantCode: "PERSISTED_QUERY_NOT_SUPPORTED"},
+		{name: "unsupported version", params: map[string]any{"extensions": map[string]any{"persistedQuery": map[string]any{"version": 2, "sha256Hash": apollo.ComputeID(registered)}}}, wantCode: "PERSISTED_QUERY_NOT_SUPPORTED"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp := postGraphQL(t, h, c.params, nil)
+			if got := resp.errorCode(); got != c.wantCode {
+				t.Fatalf("error code: want %q, got %q (%+v)", c.wantCode, got, resp.Errors)
+			}
+			if c.wantCode == "" && resp.Data["__typename"] != "Query" {
+				t.Errorf("data: want the result of the registered operation, got %v", resp.Data)
+			}
+			if c.wantCode != "" && resp.Data != nil {
+				t.Errorf("data: want nil, got %v", resp.Data)
+			}
+		})
+	}
+}
+
+type capturedOperation struct{ hash, query string }
+
+type fakeCapturer struct {
+	mu       sync.Mutex
+	captured []capturedOperation
+}
+
+func (c *fakeCapturer) CaptureUnknownOperation(_ context.Context, hash, query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.captured = append(c.captured, capturedOperation{hash: hash, query: query})
+}
+
+func TestSafelist_capture(t *testing.T) {
+	es := newTestSchema()
+	registered := "query Typename { __typename }"
+	unregistered := "query Schema { __schema { queryType { name } } }"
+	list := newTestList(t, es, apollo.Operation{Name: "Typename", Body: registered})
+
+	withQuery := func(hash, query string) map[string]any {
+		params := persistedQueryParams(hash)
+		params["query"] = query
+		return params
+	}
+	cases := []struct {
+		name   string
+		params map[string]any
+		want   []capturedOperation
+	}{
+		{name: "raw query without hash", params: map[string]any{"query": unregistered}, want: []capturedOperation{{hash: apollo.ComputeID(unregistered), query: unregistered}}},
+		{name: "raw query of unsupported version", params: map[string]any{"query": unregistered, "extensions": map[string]any{"persistedQuery": map[string]any{"version": 2}}}, want: []capturedOperation{{hash: apollo.ComputeID(unregistered), query: unregistered}}},
+		{name: "unknown hash with its body", params: withQuery(apollo.ComputeID(unregistered), unregistered), want: []capturedOperation{{hash: apollo.ComputeID(unregistered), query: unregistered}}},
+		{name: "registered raw query without hash", params: map[string]any{"query": registered}},
+		{name: "unknown hash without body", params: persistedQueryParams(apollo.ComputeID(unregistered))},
+		{name: "registered hash with another body", params: withQuery(apollo.ComputeID(registered), unregistered)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			capturer := &fakeCapturer{}
+			h := handler.New(es)
+			h.AddTransport(transport.POST{})
+			h.Use(persistedquery.Safelist{Cache: list, Capturer: capturer})
+			resp := postGraphQL(t, h, c.params, nil)
+			if len(resp.Errors) == 0 {
+				t.Fatalf("want the request rejected, got %v", resp.Data)
+			}
+			if len(capturer.captured) != len(c.want) {
+				t.Fatalf("captured: want %v, got %v", c.want, capturer.captured)
+			}
+			for i, want := range c.want {
+				if capturer.captured[i] != want {
+					t.Errorf("captured[%d]: want %v, got %v", i, want, capturer.captured[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package persistedquery
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// SignatureFileSuffix is appended to the manifest file name to get its detached signature file.
+	SignatureFileSuffix = ".sig"
+	// EnvManifestPublicKeys is the environment variable that lists the trusted public keys for ParsePublicKeys.
+	EnvManifestPublicKeys = "PERSISTED_QUERY_MANIFEST_PUBLIC_KEYS"
+)
+
+var (
+	ErrNoTrustedKeys      = errors.New("no trusted public keys")
+	ErrInvalidSignature   = errors.New("manifest signature is not valid for any trusted public key")
+	ErrMalformedPublicKey = errors.New("malformed ed25519 public key")
+	ErrMalformedSignature = errors.New("malformed ed25519 signature")
+)
+
+// SignManifest returns the base64 encoded ed25519 signature of the manifest.
+func SignManifest(key ed25519.PrivateKey, data []byte) []byte {
+	sig := ed25519.Sign(key, data)
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(sig)))
+	base64.StdEncoding.Encode(encoded, sig)
+	return append(encoded, '\n')
+}
+
+// VerifyManifestSignature verifies the base64 encoded signature with the trusted keys.
+func VerifyManifestSignature(keys []ed25519.PublicKey, data, signature []byte) error {
+	if len(keys) == 0 {
+		return ErrNoTrustedKeys
+	}
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return ErrMalformedSignature
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, data, sig) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// ParsePublicKeys parses the comma separated base64 encoded ed25519 public keys.
+// It fails with ErrNoTrustedKeys if s has no keys, so that a misconfiguration never disables the verification.
+func ParsePublicKeys(s string) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0)
+	for _, encoded := range strings.Split(s, ",") {
+		encoded = strings.TrimSpace(encoded)
+		if encoded == "" {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: %q", ErrMalformedPublicKey, encoded)
+		}
+		keys = append(keys, ed25519.PublicKey(b))
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrNoTrustedKeys, s)
+	}
+	return keys, nil
+}
+
+// TrustedKeysFromEnv returns the public keys listed in EnvManifestPublicKeys, or nil if it is not set.
+func TrustedKeysFromEnv() ([]ed25519.PublicKey, error) {
+	v := os.Getenv(EnvManifestPublicKeys)
+	if v == "" {
+		return nil, nil
+	}
+	keys, err := ParsePublicKeys(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", EnvManifestPublicKeys, err)
+	}
+	return keys, nil
+}
+
+// ParsePrivateKey parses the base64 encoded ed25519 private key or its seed.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode private key: %w", err)
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(b), nil
+	default:
+		return nil, errors.New("malformed ed25519 private key")
+	}
+}
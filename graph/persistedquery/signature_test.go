@@ -0,0 +1,118 @@
+package persistedquery
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func generateTestKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, priv
+}
+
+func TestReadManifestFile_signature(t *testing.T) {
+	trustedPub, trustedPriv := generateTestKey(t)
+	_, untrustedPriv := generateTestKey(t)
+	manifest := testManifest(t, "query A { __typename }")
+	tampered := testManifest(t, "query A { __schema { queryType { name } } }")
+	cases := []struct {
+		name      string
+		data      []byte
+		signature []byte // the .sig file is not written if nil
+		keys      []ed25519.PublicKey
+		wantErr   error
+	}{
+		{name: "signed by the trusted key", data: manifest, signature: SignManifest(trustedPriv, manifest), keys: []ed25519.PublicKey{trustedPub}},
+		{name: "signed by one of the trusted keys", data: manifest, signature: SignManifest(trustedPriv, manifest), keys: []ed25519.PublicKey{mustPublicKey(untrustedPriv), trustedPub}},
+		{name: "tampered manifest", data: tampered, signature: SignManifest(trustedPriv, manifest), keys: []ed25519.PublicKey{trustedPub}, wantErr: ErrInvalidSignature},
+		{name: "signed by an untrusted key", data: manifest, signature: SignManifest(untrustedPriv, manifest), keys: []ed25519.PublicKey{trustedPub}, wantErr: ErrInvalidSignature},
+		{name: "malformed signature", data: manifest, signature: []byte("not a signature"), keys: []ed25519.PublicKey{trustedPub}, wantErr: ErrMalformedSignature},
+		{name: "missing signature", data: manifest, keys: []ed25519.PublicKey{trustedPub}, wantErr: os.ErrNotExist},
+		{name: "no keys configured", data: tampered},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "manifest.json")
+			if err := os.WriteFile(file, c.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if c.signature != nil {
+				if err := os.WriteFile(file+SignatureFileSuffix, c.signature, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var opts []DecodeOption
+			if c.keys != nil {
+				opts = append(opts, WithTrustedKeys(c.keys...))
+			}
+			_, err := ReadManifestFile(file, opts...)
+			if c.wantErr == nil {
+				if err != nil {
+					t.Errorf("want no error, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, c.wantErr) {
+				t.Errorf("want %v, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
+
+func mustPublicKey(priv ed25519.PrivateKey) ed25519.PublicKey {
+	return priv.Public().(ed25519.PublicKey)
+}
+
+func TestVerifyManifestSignature_noKeys(t *testing.T) {
+	_, priv := generateTestKey(t)
+	data := []byte("{}")
+	if err := VerifyManifestSignature(nil, data, SignManifest(priv, data)); !errors.Is(err, ErrNoTrustedKeys) {
+		t.Errorf("want ErrNoTrustedKeys, got %v", err)
+	}
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	pub1, _ := generateTestKey(t)
+	pub2, _ := generateTestKey(t)
+	encoded1 := base64.StdEncoding.EncodeToString(pub1)
+	encoded2 := base64.StdEncoding.EncodeToString(pub2)
+	cases := []struct {
+		name     string
+		input    string
+		wantKeys int
+		wantErr  error
+	}{
+		{name: "one key", input: encoded1, wantKeys: 1},
+		{name: "keys with spaces and a trailing comma", input: " " + encoded1 + " , " + encoded2 + ",", wantKeys: 2},
+		{name: "empty", input: "", wantErr: ErrNoTrustedKeys},
+		{name: "only separators", input: " , ", wantErr: ErrNoTrustedKeys},
+		{name: "malformed key", input: encoded1 + ",bad", wantErr: ErrMalformedPublicKey},
+		{name: "wrong size", input: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 16))), wantErr: ErrMalformedPublicKey},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			keys, err := ParsePublicKeys(c.input)
+			if c.wantErr != nil {
+				if !errors.Is(err, c.wantErr) {
+					t.Errorf("want %v, got %v", c.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want no error, got %v", err)
+			}
+			if len(keys) != c.wantKeys {
+				t.Errorf("want %d keys, got %d", c.wantKeys, len(keys))
+			}
+		})
+	}
+}
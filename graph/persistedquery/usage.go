@@ -0,0 +1,297 @@
+package persistedquery
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/aereal/poc-graphql-pqs-server/domain"
+)
+
+const (
+	maxLatencySamples = 1024
+	finalFlushTimeout = time.Second * 5
+	// defaultMaxUsageClients bounds the number of distinct client names since the names are sent by clients.
+	defaultMaxUsageClients = 100
+	// otherClientName is the client name that the usage of the clients beyond the limit is counted under.
+	otherClientName = "(other)"
+)
+
+// UsageStat is the usage of a persisted operation by a client.
+type UsageStat struct {
+	OperationID   string `json:"operationId"`
+	OperationName string `json:"operationName"`
+	ClientName    string `json:"clientName"`
+	// AliasOf is the ID of the replacement operation if OperationID is an alias.
+	AliasOf      string    `json:"aliasOf,omitempty"`
+	Executions   uint64    `json:"executions"`
+	Errors       uint64    `json:"errors"`
+	LatencyP50Ms float64   `json:"latencyP50Ms"`
+	LatencyP90Ms float64   `json:"latencyP90Ms"`
+	LatencyP99Ms float64   `json:"latencyP99Ms"`
+	LastSeen     time.Time `json:"lastSeen"`
+}
+
+type usageKey struct {
+	operationID string
+	clientName  string
+}
+
+type usageCounter struct {
+	operationName string
+	aliasOf       string
+	executions    uint64
+	errors        uint64
+	lastSeen      time.Time
+	// latencies is a ring buffer of the recent latencies used to compute the percentiles.
+	latencies []time.Duration
+	next      int
+}
+
+func (c *usageCounter) record(latency time.Duration, failed bool, now time.Time) {
+	c.executions++
+	if failed {
+		c.errors++
+	}
+	c.lastSeen = now
+	if len(c.latencies) < maxLatencySamples {
+		c.latencies = append(c.latencies, latency)
+		return
+	}
+	c.latencies[c.next] = latency
+	c.next = (c.next + 1) % maxLatencySamples
+}
+
+func (c *usageCounter) stat(key usageKey) UsageStat {
+	sorted := make([]time.Duration, len(c.latencies))
+	copy(sorted, c.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return UsageStat{
+		OperationID:   key.operationID,
+		OperationName: c.operationName,
+		ClientName:    key.clientName,
+		AliasOf:       c.aliasOf,
+		Executions:    c.executions,
+		Errors:        c.errors,
+		LatencyP50Ms:  percentileMs(sorted, 0.5),
+		LatencyP90Ms:  percentileMs(sorted, 0.9),
+		LatencyP99Ms:  percentileMs(sorted, 0.99),
+		LastSeen:      c.lastSeen,
+	}
+}
+
+func percentileMs(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p)
+	return float64(sorted[idx]) / float64(time.Millisecond)
+}
+
+type usageRecorderConfig struct {
+	maxClients int
+}
+
+type UsageRecorderOption func(*usageRecorderConfig)
+
+// WithMaxUsageClients sets the number of distinct client names counted separately.
+// The usage of the other clients is counted under "(other)".
+func WithMaxUsageClients(n int) UsageRecorderOption {
+	return func(c *usageRecorderConfig) { c.maxClients = n }
+}
+
+func NewUsageRecorder(cache graphql.Cache, opts ...UsageRecorderOption) *UsageRecorder {
+	cfg := &usageRecorderConfig{maxClients: defaultMaxUsageClients}
+	for _, o := range opts {
+		o(cfg)
+	}
+	return &UsageRecorder{
+		cache:      cache,
+		maxClients: cfg.maxClients,
+		clients:    make(map[string]struct{}),
+		total:      make(map[usageKey]*usageCounter),
+		window:     make(map[usageKey]*usageCounter),
+	}
+}
+
+// UsageRecorder is a handler extension that counts executions, errors and latencies per persisted operation ID and client name.
+type UsageRecorder struct {
+	cache      graphql.Cache
+	maxClients int
+
+	mu      sync.Mutex
+	clients map[string]struct{}
+	total   map[usageKey]*usageCounter
+	window  map[usageKey]*usageCounter // since the last flush
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+} = (*UsageRecorder)(nil)
+
+func (*UsageRecorder) ExtensionName() string { return "PersistedQueryUsageRecorder" }
+
+func (r *UsageRecorder) Validate(graphql.ExecutableSchema) error {
+	if r.cache == nil {
+		return ErrNilCache
+	}
+	return nil
+}
+
+func (r *UsageRecorder) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	if resp == nil || !graphql.HasOperationContext(ctx) {
+		return resp
+	}
+	id := persistedQueryID(ctx)
+	if id == "" {
+		return resp
+	}
+	var name string
+	if op := currentOperation(ctx, r.cache); op != nil {
+		name = op.Name
+	}
+	var aliasOf string
+	if alias, ok := lookupAlias(ctx, r.cache, id); ok {
+		aliasOf = alias.Target
+	}
+	var clientName string
+	if info, ok := ClientInfoFromContext(ctx); ok {
+		clientName = info.Name
+	}
+	now := graphql.Now()
+	latency := now.Sub(graphql.GetOperationContext(ctx).Stats.OperationStart)
+	r.record(usageKey{operationID: id, clientName: clientName}, name, aliasOf, latency, len(resp.Errors) > 0, now)
+	return resp
+}
+
+func persistedQueryID(ctx context.Context) string {
+	if stats := GetStats(ctx); stats != nil {
+		return stats.ID
+	}
+	if stats := extension.GetApqStats(ctx); stats != nil && !stats.SentQuery {
+		return stats.Hash
+	}
+	return ""
+}
+
+func (r *UsageRecorder) record(key usageKey, name, aliasOf string, latency time.Duration, failed bool, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clients[key.clientName]; !ok {
+		if len(r.clients) >= r.maxClients {
+			key.clientName = otherClientName
+		} else {
+			r.clients[key.clientName] = struct{}{}
+		}
+	}
+	for _, counters := range []map[usageKey]*usageCounter{r.total, r.window} {
+		c, ok := counters[key]
+		if !ok {
+			c = &usageCounter{operationName: name, aliasOf: aliasOf}
+			counters[key] = c
+		}
+		c.record(latency, failed, now)
+	}
+}
+
+// Snapshot returns the usage since the server started.
+func (r *UsageRecorder) Snapshot() []UsageStat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return collectStats(r.total)
+}
+
+func collectStats(counters map[usageKey]*usageCounter) []UsageStat {
+	stats := make([]UsageStat, 0, len(counters))
+	for key, c := range counters {
+		stats = append(stats, c.stat(key))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].OperationID != stats[j].OperationID {
+			return stats[i].OperationID < stats[j].OperationID
+		}
+		return stats[i].ClientName < stats[j].ClientName
+	})
+	return stats
+}
+
+// Flush stores the usage since the last flush.
+// The usage is kept for the next flush if storing fails.
+func (r *UsageRecorder) Flush(ctx context.Context, repo *domain.OperationUsageRepository) error {
+	r.mu.Lock()
+	window := r.window
+	r.window = make(map[usageKey]*usageCounter)
+	r.mu.Unlock()
+
+	now := time.Now()
+	stats := collectStats(window)
+	usages := make([]*domain.OperationUsage, len(stats))
+	for i, stat := range stats {
+		usages[i] = &domain.OperationUsage{
+			OperationID:   stat.OperationID,
+			OperationName: stat.OperationName,
+			ClientName:    stat.ClientName,
+			Executions:    stat.Executions,
+			Errors:        stat.Errors,
+			LatencyP50Ms:  stat.LatencyP50Ms,
+			LatencyP90Ms:  stat.LatencyP90Ms,
+			LatencyP99Ms:  stat.LatencyP99Ms,
+			RecordedAt:    now,
+		}
+	}
+	if err := repo.RecordOperationUsages(ctx, usages); err != nil {
+		r.restore(window)
+		return err
+	}
+	return nil
+}
+
+func (r *UsageRecorder) restore(window map[usageKey]*usageCounter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, c := range window {
+		current, ok := r.window[key]
+		if !ok {
+			r.window[key] = c
+			continue
+		}
+		current.executions += c.executions
+		current.errors += c.errors
+		for _, latency := range c.latencies {
+			if len(current.latencies) >= maxLatencySamples {
+				break
+			}
+			current.latencies = append(current.latencies, latency)
+		}
+		if c.lastSeen.After(current.lastSeen) {
+			current.lastSeen = c.lastSeen
+		}
+	}
+}
+
+// RunFlusher flushes the usage every interval until ctx is done, and flushes the rest once more on return.
+func (r *UsageRecorder) RunFlusher(ctx context.Context, repo *domain.OperationUsageRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finalFlushTimeout)
+			defer cancel()
+			if err := r.Flush(flushCtx, repo); err != nil {
+				slog.WarnContext(ctx, "failed to flush operation usage", slog.String("error", err.Error()))
+			}
+			return
+		case <-ticker.C:
+			if err := r.Flush(ctx, repo); err != nil {
+				slog.WarnContext(ctx, "failed to flush operation usage", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package persistedquery
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+type OperationValidationError struct {
+	ID     string
+	Name   string
+	Errors gqlerror.List
+}
+
+func (e *OperationValidationError) Error() string {
+	return fmt.Sprintf("operation (id=%q name=%q) is invalid: %s", e.ID, e.Name, e.Errors.Error())
+}
+
+func (e *OperationValidationError) Unwrap() error { return e.Errors }
+
+// ValidateDocument parses the body and validates it against the schema.
+func ValidateDocument(schema *ast.Schema, body string) (*ast.QueryDocument, gqlerror.List) {
+	doc, errs := gqlparser.LoadQuery(schema, body)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(doc.Operations) == 0 {
+		return nil, gqlerror.List{gqlerror.Errorf("no operation provided")}
+	}
+	return doc, nil
+}
+
+// ValidateManifest validates all operations in the manifest and reports every invalid operation.
+func ValidateManifest(schema *ast.Schema, manifest *apollo.Manifest) error {
+	_, err := prepareManifest(schema, manifest)
+	return err
+}
+
+// prepareManifest validates the manifest and returns the documents keyed by the operation body.
+func prepareManifest(schema *ast.Schema, manifest *apollo.Manifest) (map[string]*ast.QueryDocument, error) {
+	var err error
+	documents := make(map[string]*ast.QueryDocument, len(manifest.Operations))
+	for _, op := range manifest.Operations {
+		doc, errs := ValidateDocument(schema, op.Body)
+		if len(errs) == 0 {
+			errs = append(validateOperationMetadata(doc, op), validateVariableConstraints(doc, op)...)
+		}
+		if len(errs) > 0 {
+			err = errors.Join(err, &OperationValidationError{ID: op.ID, Name: op.Name, Errors: errs})
+			continue
+		}
+		documents[op.Body] = doc
+	}
+	for _, alias := range manifest.Aliases {
+		if alias.Variables == nil {
+			continue
+		}
+		target := findOperation(manifest.Operations, alias.Target)
+		if target == nil {
+			continue
+		}
+		doc, ok := documents[target.Body]
+		if !ok {
+			continue
+		}
+		if errs := validateVariableTransform(doc, *target, alias.Variables); len(errs) > 0 {
+			err = errors.Join(err, &OperationValidationError{ID: alias.ID, Name: target.Name, Errors: errs})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// validateOperationMetadata checks that the document has the operation of the recorded name and type.
+func validateOperationMetadata(doc *ast.QueryDocument, op apollo.Operation) gqlerror.List {
+	var errs gqlerror.List
+	definition := doc.Operations.ForName(op.Name)
+	if op.Name != "" && definition == nil {
+		return append(errs, gqlerror.Errorf("document has no operation named %s", op.Name))
+	}
+	if definition == nil {
+		definition = doc.Operations[0]
+	}
+	if op.Type != "" && definition.Operation != ast.Operation(op.Type) {
+		errs = append(errs, gqlerror.Errorf("operation type %s does not match the recorded type %s", definition.Operation, op.Type))
+	}
+	return errs
+}
+
+func validateVariableConstraints(doc *ast.QueryDocument, op apollo.Operation) gqlerror.List {
+	var errs gqlerror.List
+	definition := operationDefinition(doc, op)
+	for name := range op.Variables {
+		if definition.VariableDefinitions.ForName(name) == nil {
+			errs = append(errs, gqlerror.Errorf("variable constraint refers to undefined variable $%s", name))
+		}
+	}
+	return errs
+}
+
+// validateVariableTransform checks that the alias produces only the variables that the target operation defines.
+func validateVariableTransform(doc *ast.QueryDocument, target apollo.Operation, transform *apollo.VariableTransform) gqlerror.List {
+	var errs gqlerror.List
+	definition := operationDefinition(doc, target)
+	for _, name := range transform.Rename {
+		if definition.VariableDefinitions.ForName(name) == nil {
+			errs = append(errs, gqlerror.Errorf("alias renames a variable to $%s that the target operation does not define", name))
+		}
+	}
+	for name := range transform.Set {
+		if definition.VariableDefinitions.ForName(name) == nil {
+			errs = append(errs, gqlerror.Errorf("alias sets variable $%s that the target operation does not define", name))
+		}
+	}
+	return errs
+}
+
+func operationDefinition(doc *ast.QueryDocument, op apollo.Operation) *ast.OperationDefinition {
+	if definition := doc.Operations.ForName(op.Name); definition != nil {
+		return definition
+	}
+	return doc.Operations[0]
+}
+
+func findOperation(ops []apollo.Operation, id string) *apollo.Operation {
+	for i := range ops {
+		if ops[i].ID == id {
+			return &ops[i]
+		}
+	}
+	return nil
+}
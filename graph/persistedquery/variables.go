@@ -0,0 +1,159 @@
+package persistedquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const errVariableConstraintViolationCode = "VARIABLE_CONSTRAINT_VIOLATION"
+
+// VariableConstraints is a handler extension that checks the variables against apollo.VariableConstraint of the persisted operation.
+//
+// It must be used after the extension that resolves the persisted query such as Safelist.
+type VariableConstraints struct {
+	Cache graphql.Cache
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+} = VariableConstraints{}
+
+func (VariableConstraints) ExtensionName() string { return "PersistedQueryVariableConstraints" }
+
+func (v VariableConstraints) Validate(graphql.ExecutableSchema) error {
+	if v.Cache == nil {
+		return ErrNilCache
+	}
+	return nil
+}
+
+func (v VariableConstraints) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	op := currentOperation(ctx, v.Cache)
+	if op == nil || len(op.Variables) == 0 {
+		return nil
+	}
+	if rawParams.Variables == nil {
+		rawParams.Variables = make(map[string]any)
+	}
+	names := make([]string, 0, len(op.Variables))
+	for name := range op.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := applyConstraint(name, op.Variables[name], rawParams.Variables); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyConstraint(name string, constraint apollo.VariableConstraint, variables map[string]any) *gqlerror.Error {
+	value, given := variables[name]
+	if constraint.Fixed != nil {
+		if given && !sameValue(value, constraint.Fixed) {
+			return newViolationError(name, "variable $%s must be %s", name, formatValue(constraint.Fixed))
+		}
+		variables[name] = constraint.Fixed
+		return nil
+	}
+	if !given || value == nil {
+		if constraint.Default != nil {
+			variables[name] = constraint.Default
+		}
+		return nil
+	}
+	if constraint.Min != nil || constraint.Max != nil {
+		n, ok := asFloat(value)
+		if !ok {
+			return newViolationError(name, "variable $%s must be a number", name)
+		}
+		if (constraint.Min != nil && n < *constraint.Min) || (constraint.Max != nil && n > *constraint.Max) {
+			return newViolationError(name, "variable $%s must be %s", name, formatRange(constraint.Min, constraint.Max))
+		}
+	}
+	if len(constraint.OneOf) > 0 {
+		for _, allowed := range constraint.OneOf {
+			if sameValue(value, allowed) {
+				return nil
+			}
+		}
+		return newViolationError(name, "variable $%s must be one of %s", name, formatValue(constraint.OneOf))
+	}
+	return nil
+}
+
+func newViolationError(name string, format string, args ...any) *gqlerror.Error {
+	err := gqlerror.Errorf(format, args...)
+	errcode.Set(err, errVariableConstraintViolationCode)
+	err.Extensions["variable"] = name
+	return err
+}
+
+// sameValue compares the numbers numerically because both the variables and the manifest keep numbers as they are written, such as 10 and 10.0.
+// The other values are compared by their JSON representations.
+func sameValue(a, b any) bool {
+	if na, ok := asNumber(a); ok {
+		nb, ok := asNumber(b)
+		return ok && na == nb
+	}
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// asNumber is like asFloat but does not accept numeric strings.
+func asNumber(v any) (float64, bool) {
+	if _, ok := v.(string); ok {
+		return 0, false
+	}
+	return asFloat(v)
+}
+
+func asFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func formatValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func formatRange(min, max *float64) string {
+	switch {
+	case min != nil && max != nil:
+		return fmt.Sprintf("between %g and %g", *min, *max)
+	case min != nil:
+		return fmt.Sprintf("greater than or equal to %g", *min)
+	default:
+		return fmt.Sprintf("less than or equal to %g", *max)
+	}
+}
@@ -0,0 +1,77 @@
+package persistedquery
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+)
+
+// decodeJSON decodes the JSON as the manifest decoder and the POST transport do.
+func decodeJSON(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestApplyConstraint(t *testing.T) {
+	cases := []struct {
+		name       string
+		constraint string // in the manifest
+		variables  string // sent by the client
+		want       any    // the variable after applying the constraint
+		wantErr    bool
+	}{
+		{name: "fixed: omitted", constraint: `{"fixed": 10}`, variables: `{}`, want: json.Number("10")},
+		{name: "fixed: same value", constraint: `{"fixed": 10}`, variables: `{"v": 10}`, want: json.Number("10")},
+		{name: "fixed: same number in another notation", constraint: `{"fixed": 10}`, variables: `{"v": 10.0}`, want: json.Number("10")},
+		{name: "fixed: another value", constraint: `{"fixed": 10}`, variables: `{"v": 11}`, wantErr: true},
+		{name: "fixed: number as string", constraint: `{"fixed": 10}`, variables: `{"v": "10"}`, wantErr: true},
+		{name: "fixed: object", constraint: `{"fixed": {"a": 1, "b": "x"}}`, variables: `{"v": {"b": "x", "a": 1}}`, want: map[string]any{"a": json.Number("1"), "b": "x"}},
+		{name: "default: omitted", constraint: `{"default": "ASC"}`, variables: `{}`, want: "ASC"},
+		{name: "default: null", constraint: `{"default": "ASC"}`, variables: `{"v": null}`, want: "ASC"},
+		{name: "default: given", constraint: `{"default": "ASC"}`, variables: `{"v": "DESC"}`, want: "DESC"},
+		{name: "range: within", constraint: `{"min": 1, "max": 100}`, variables: `{"v": 100}`, want: json.Number("100")},
+		{name: "range: below min", constraint: `{"min": 1, "max": 100}`, variables: `{"v": 0}`, wantErr: true},
+		{name: "range: above max", constraint: `{"min": 1, "max": 100}`, variables: `{"v": 100.5}`, wantErr: true},
+		{name: "range: not a number", constraint: `{"max": 100}`, variables: `{"v": true}`, wantErr: true},
+		{name: "oneOf: listed", constraint: `{"oneOf": ["ASC", "DESC"]}`, variables: `{"v": "DESC"}`, want: "DESC"},
+		{name: "oneOf: not listed", constraint: `{"oneOf": ["ASC", "DESC"]}`, variables: `{"v": "RANDOM"}`, wantErr: true},
+		{name: "oneOf: number in exponent notation", constraint: `{"oneOf": [1, 2]}`, variables: `{"v": 1e0}`, want: json.Number("1e0")},
+		{name: "oneOf: number as string", constraint: `{"oneOf": [1, 2]}`, variables: `{"v": "1"}`, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var constraint apollo.VariableConstraint
+			dec := json.NewDecoder(strings.NewReader(c.constraint))
+			dec.UseNumber()
+			if err := dec.Decode(&constraint); err != nil {
+				t.Fatal(err)
+			}
+			variables := decodeJSON(t, c.variables).(map[string]any)
+			err := applyConstraint("v", constraint, variables)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("want an error, got the variable %#v", variables["v"])
+				}
+				if code := err.Extensions["code"]; code != errVariableConstraintViolationCode {
+					t.Errorf("code: want %q, got %v", errVariableConstraintViolationCode, code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want no error, got %v", err)
+			}
+			if !reflect.DeepEqual(variables["v"], c.want) {
+				t.Errorf("variable: want %#v, got %#v", c.want, variables["v"])
+			}
+		})
+	}
+}
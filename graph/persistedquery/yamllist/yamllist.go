@@ -0,0 +1,51 @@
+package yamllist
+
+import (
+	"fmt"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"gopkg.in/yaml.v3"
+)
+
+const Format = "yaml-list"
+
+type entry struct {
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+	Body string `yaml:"body"`
+}
+
+// Detect reports whether the data looks like a YAML list of operations.
+func Detect(data []byte) bool {
+	var entries []entry
+	return yaml.Unmarshal(data, &entries) == nil && len(entries) > 0
+}
+
+// Decode converts a YAML list of operations into a manifest.
+//
+// The id of each entry may be omitted; it is computed from the body in that case.
+func Decode(data []byte) (*apollo.Manifest, error) {
+	var entries []entry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode YAML list: %w", err)
+	}
+	manifest := &apollo.Manifest{Format: apollo.SupportedFormat, Version: apollo.SupportedVersion, Operations: make([]apollo.Operation, 0, len(entries))}
+	for _, e := range entries {
+		id := e.ID
+		if id == "" {
+			id = apollo.ComputeID(e.Body)
+		}
+		op, err := apollo.NewOperation(id, e.Body)
+		if err != nil {
+			return nil, err
+		}
+		if e.Name != "" {
+			op.Name = e.Name
+		}
+		manifest.Operations = append(manifest.Operations, op)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,141 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/aereal/poc-graphql-pqs-server/domain"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery/apollo"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	adminPersistedOperationsPath = "/admin/persisted-operations"
+	adminUsagePath               = "/admin/usage"
+)
+
+func (s *Server) withAdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeAdminError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handlerAdminPersistedOperations() http.Handler {
+	return s.withAdminAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, adminPersistedOperationsPath), "/")
+		switch {
+		case id == "" && r.Method == http.MethodGet:
+			s.listPersistedOperations(w, r)
+		case id == "" && r.Method == http.MethodPost:
+			s.registerPersistedOperation(w, r)
+		case id != "" && r.Method == http.MethodDelete:
+			s.retirePersistedOperation(w, r, id)
+		default:
+			writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	}))
+}
+
+func (s *Server) listPersistedOperations(w http.ResponseWriter, r *http.Request) {
+	ops, err := s.operationStore.List(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list persisted operations", slog.String("error", err.Error()))
+		writeAdminError(w, http.StatusInternalServerError, errors.New("failed to list persisted operations"))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]any{"operations": ops})
+}
+
+type registerPersistedOperationInput struct {
+	Name          string `json:"name"`
+	Body          string `json:"body"`
+	ClientName    string `json:"clientName"`
+	ClientVersion string `json:"clientVersion"`
+}
+
+func (s *Server) registerPersistedOperation(w http.ResponseWriter, r *http.Request) {
+	var input registerPersistedOperationInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	if input.Body == "" {
+		writeAdminError(w, http.StatusBadRequest, apollo.ErrEmptyBody)
+		return
+	}
+	if _, errs := persistedquery.ValidateDocument(s.executableSchema.Schema(), input.Body); len(errs) > 0 {
+		writeAdminJSON(w, http.StatusUnprocessableEntity, map[string]gqlerror.List{"errors": errs})
+		return
+	}
+	op, err := apollo.NewOperation(apollo.ComputeID(input.Body), input.Body)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	if input.Name != "" && input.Name != op.Name {
+		writeAdminError(w, http.StatusUnprocessableEntity, errors.New("name does not match the operation name in the body"))
+		return
+	}
+	registered, err := s.operationStore.Register(r.Context(), &domain.PersistedOperation{
+		ID:            op.ID,
+		Name:          op.Name,
+		Type:          op.Type,
+		Body:          op.Body,
+		ClientName:    input.ClientName,
+		ClientVersion: input.ClientVersion,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to register persisted operation", slog.String("error", err.Error()))
+		writeAdminError(w, http.StatusInternalServerError, errors.New("failed to register persisted operation"))
+		return
+	}
+	slog.InfoContext(r.Context(), "persisted operation registered", slog.String("id", registered.ID), slog.String("name", registered.Name), slog.String("client_name", registered.ClientName), slog.String("client_version", registered.ClientVersion))
+	writeAdminJSON(w, http.StatusCreated, registered)
+}
+
+func (s *Server) retirePersistedOperation(w http.ResponseWriter, r *http.Request, id string) {
+	retired, err := s.operationStore.Retire(r.Context(), id)
+	if err != nil {
+		var notFound *domain.NotFoundError[string, *domain.PersistedOperation]
+		if errors.As(err, &notFound) {
+			writeAdminError(w, http.StatusNotFound, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to retire persisted operation", slog.String("error", err.Error()))
+		writeAdminError(w, http.StatusInternalServerError, errors.New("failed to retire persisted operation"))
+		return
+	}
+	slog.InfoContext(r.Context(), "persisted operation retired", slog.String("id", retired.ID))
+	writeAdminJSON(w, http.StatusOK, retired)
+}
+
+func (s *Server) handlerAdminUsage() http.Handler {
+	return s.withAdminAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, map[string]any{"usages": s.usageRecorder.Snapshot()})
+	}))
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+)
+
+var varyHeaders = strings.Join([]string{"Accept", persistedquery.HeaderClientName, persistedquery.HeaderClientVersion}, ", ")
+
+// withHTTPCaching adds the cache headers to the successful GET responses and answers conditional requests with 304 Not Modified.
+// The cache hint given by the operation policy takes precedence over maxAge.
+func withHTTPCaching(maxAge time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, hint := persistedquery.WithCacheHint(r.Context())
+		rec := &bufferedResponseWriter{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		header := w.Header()
+		for k, vs := range rec.header {
+			header[k] = vs
+		}
+		header.Add("Vary", varyHeaders)
+		if rec.status != http.StatusOK || hasErrors(rec.body.Bytes()) {
+			header.Set("Cache-Control", "no-store")
+			w.WriteHeader(rec.status)
+			_, _ = w.Write(rec.body.Bytes())
+			return
+		}
+		etag := computeETag(rec.body.Bytes())
+		header.Set("ETag", etag)
+		if hint.MaxAge > 0 {
+			header.Set("Cache-Control", cacheControl(hint.MaxAge))
+		} else {
+			header.Set("Cache-Control", cacheControl(maxAge))
+		}
+		if matchETag(r.Header.Get("If-None-Match"), etag) {
+			header.Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(rec.status)
+		_, _ = w.Write(rec.body.Bytes())
+	})
+}
+
+func cacheControl(maxAge time.Duration) string {
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+}
+
+func computeETag(body []byte) string {
+	h := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(h[:16]) + `"`
+}
+
+func matchETag(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasErrors(body []byte) bool {
+	var resp struct {
+		Errors []json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return true
+	}
+	return len(resp.Errors) > 0
+}
+
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+var _ http.ResponseWriter = (*bufferedResponseWriter)(nil)
+
+func (w *bufferedResponseWriter) Header() http.Header { return w.header }
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+
+func (w *bufferedResponseWriter) WriteHeader(status int) { w.status = status }
@@ -0,0 +1,53 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
+)
+
+// withDeprecationHeaders adds Deprecation and Sunset headers to the responses of deprecated operations.
+func withDeprecationHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, notice := persistedquery.WithDeprecationNotice(r.Context())
+		next.ServeHTTP(&deprecationHeaderWriter{ResponseWriter: w, notice: notice}, r.WithContext(ctx))
+	})
+}
+
+// deprecationHeaderWriter sets the headers just before the response header is written, when the operation is already resolved.
+type deprecationHeaderWriter struct {
+	http.ResponseWriter
+	notice      *persistedquery.DeprecationNotice
+	wroteHeader bool
+}
+
+func (w *deprecationHeaderWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.notice.Deprecated {
+			header := w.Header()
+			header.Set("Deprecation", deprecationHeaderValue(w.notice.Date))
+			if w.notice.Sunset != nil {
+				header.Set("Sunset", w.notice.Sunset.UTC().Format(http.TimeFormat))
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *deprecationHeaderWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// deprecationHeaderValue returns the structured date of RFC 9745, or the draft syntax when the date is unknown.
+func deprecationHeaderValue(date *time.Time) string {
+	if date == nil {
+		return "true"
+	}
+	return "@" + strconv.FormatInt(date.Unix(), 10)
+}
@@ -19,12 +19,17 @@ import (
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/aereal/otelgqlgen"
 	"github.com/aereal/poc-graphql-pqs-server/graph/loaders"
+	"github.com/aereal/poc-graphql-pqs-server/graph/persistedquery"
 	"github.com/rs/cors"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
 )
 
-const defaultPort = "8080"
+const (
+	defaultPort   = "8080"
+	headerTraceID = "X-Trace-Id"
+)
 
 var shutdownGrace = time.Second * 5
 
@@ -42,6 +47,38 @@ func WithPersistedQueryList(queryList graphql.Cache) Option {
 	return func(s *Server) { s.queryList = queryList }
 }
 
+func WithStrictSafelist(on bool) Option { return func(s *Server) { s.strictSafelist = on } }
+
+func WithDocumentIDPrefixes(prefixes ...string) Option {
+	return func(s *Server) { s.documentIDPrefixes = prefixes }
+}
+
+// WithAdminToken enables the admin API authenticated by the bearer token.
+func WithAdminToken(token string) Option { return func(s *Server) { s.adminToken = token } }
+
+// WithOperationStore exposes the persisted operations in the store on the admin API.
+func WithOperationStore(store *persistedquery.DBStore) Option {
+	return func(s *Server) { s.operationStore = store }
+}
+
+// WithUsageRecorder records the usage of persisted operations on the public endpoint and exposes it on the admin API.
+func WithUsageRecorder(recorder *persistedquery.UsageRecorder) Option {
+	return func(s *Server) { s.usageRecorder = recorder }
+}
+
+// WithUnknownOperationCapturer captures the unregistered queries rejected by the strict safelist.
+func WithUnknownOperationCapturer(capturer persistedquery.UnknownOperationCapturer) Option {
+	return func(s *Server) { s.unknownOperationCapturer = capturer }
+}
+
+// WithGetCacheMaxAge sets max-age of Cache-Control for the successful GET responses on the public endpoint.
+// The responses must be revalidated with ETag if it is zero.
+func WithGetCacheMaxAge(d time.Duration) Option { return func(s *Server) { s.getCacheMaxAge = d } }
+
+func WithPolicyOptions(opts ...persistedquery.PolicyOption) Option {
+	return func(s *Server) { s.policyOptions = opts }
+}
+
 func New(opts ...Option) *Server {
 	s := &Server{}
 	for _, o := range opts {
@@ -54,10 +91,18 @@ func New(opts ...Option) *Server {
 }
 
 type Server struct {
-	port             string
-	executableSchema graphql.ExecutableSchema
-	loaderRoot       *loaders.Root
-	queryList        graphql.Cache
+	port                     string
+	executableSchema         graphql.ExecutableSchema
+	loaderRoot               *loaders.Root
+	queryList                graphql.Cache
+	strictSafelist           bool
+	documentIDPrefixes       []string
+	adminToken               string
+	operationStore           *persistedquery.DBStore
+	getCacheMaxAge           time.Duration
+	policyOptions            []persistedquery.PolicyOption
+	usageRecorder            *persistedquery.UsageRecorder
+	unknownOperationCapturer persistedquery.UnknownOperationCapturer
 }
 
 func (s *Server) handlerRoot() http.Handler {
@@ -69,23 +114,53 @@ func (s *Server) handler() http.Handler {
 	mux.Handle("/", s.handlerRoot())
 	mux.Handle("/graphql", s.handlerGraphql(false))
 	mux.Handle("/public/graphql", s.handlerGraphql(true))
+	if s.adminToken != "" && s.operationStore != nil {
+		mux.Handle(adminPersistedOperationsPath, s.handlerAdminPersistedOperations())
+		mux.Handle(adminPersistedOperationsPath+"/", s.handlerAdminPersistedOperations())
+	}
+	if s.adminToken != "" && s.usageRecorder != nil {
+		mux.Handle(adminUsagePath, s.handlerAdminUsage())
+	}
 	return withOtel(mux)
 }
 
 func (s *Server) handlerGraphql(public bool) http.Handler {
 	h := handler.New(s.executableSchema)
-	h.AddTransport(transport.POST{})
 	if public {
-		h.Use(extension.AutomaticPersistedQuery{Cache: s.queryList})
+		h.AddTransport(persistedquery.DocumentIDTransport{Transport: transport.GET{}})
+		h.AddTransport(persistedquery.DocumentIDTransport{Transport: transport.POST{}})
+		h.SetQueryCache(persistedquery.DocumentCache{Cache: s.queryList})
+		h.Use(persistedquery.ClientCheck{Cache: s.queryList})
+		h.Use(persistedquery.PersistedDocument{Cache: s.queryList, Prefixes: s.documentIDPrefixes})
+		h.Use(persistedquery.AliasedQuery{Cache: s.queryList})
+		if s.strictSafelist {
+			h.Use(persistedquery.Safelist{Cache: s.queryList, Capturer: s.unknownOperationCapturer})
+		} else {
+			h.Use(extension.AutomaticPersistedQuery{Cache: s.queryList})
+		}
+		h.Use(persistedquery.OperationMetadataCheck{Cache: s.queryList})
+		h.Use(persistedquery.AliasVariables{Cache: s.queryList})
+		h.Use(persistedquery.VariableConstraints{Cache: s.queryList})
+		h.Use(persistedquery.NewPolicyEnforcer(s.queryList, s.policyOptions...))
 	} else {
+		h.AddTransport(transport.POST{})
 		h.Use(extension.Introspection{})
 	}
+	if public && s.usageRecorder != nil {
+		h.Use(s.usageRecorder)
+	}
 	h.Use(otelgqlgen.New())
 	h.Use(s.loaderRoot)
 	opts := cors.Options{
 		AllowedMethods:   []string{http.MethodPost},
 		AllowCredentials: true,
 	}
+	if public {
+		opts.AllowedMethods = append(opts.AllowedMethods, http.MethodGet)
+		opts.ExposedHeaders = []string{"Deprecation", "Sunset", headerTraceID}
+		opts.AllowedHeaders = []string{"Content-Type", persistedquery.HeaderClientName, persistedquery.HeaderClientVersion}
+		return cors.New(opts).Handler(persistedquery.ClientInfoMiddleware(withDeprecationHeaders(withHTTPCaching(s.getCacheMaxAge, h))))
+	}
 	return cors.New(opts).Handler(h)
 }
 
@@ -96,7 +171,9 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer cancel()
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-ctx.Done()
 		slog.DebugContext(ctx, "shutting down server", slog.Duration("shutdown_grace", shutdownGrace))
 		ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
@@ -109,11 +186,23 @@ func (s *Server) Start(ctx context.Context) error {
 	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
+	// ListenAndServe returns as soon as Shutdown is called, so wait for the in-flight requests
+	<-shutdownDone
 	return nil
 }
 
 func withOtel(next http.Handler) http.Handler {
-	return otelhttp.NewMiddleware("", otelhttp.WithMessageEvents(otelhttp.ReadEvents, otelhttp.WriteEvents), otelhttp.WithSpanNameFormatter(formatSpanName), otelhttp.WithPublicEndpoint(), otelhttp.WithClientTrace(func(ctx context.Context) *httptrace.ClientTrace { return otelhttptrace.NewClientTrace(ctx) }))(next)
+	return otelhttp.NewMiddleware("", otelhttp.WithMessageEvents(otelhttp.ReadEvents, otelhttp.WriteEvents), otelhttp.WithSpanNameFormatter(formatSpanName), otelhttp.WithPublicEndpoint(), otelhttp.WithClientTrace(func(ctx context.Context) *httptrace.ClientTrace { return otelhttptrace.NewClientTrace(ctx) }))(withTraceIDHeader(next))
+}
+
+// withTraceIDHeader tells the trace ID of the request to clients so that they can refer to it on debugging.
+func withTraceIDHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+			w.Header().Set(headerTraceID, sc.TraceID().String())
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func formatSpanName(_ string, r *http.Request) string {